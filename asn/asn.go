@@ -1,7 +1,9 @@
 package asn
 
 import (
+	"context"
 	"fmt"
+	"iter"
 	"net"
 	"strconv"
 	"strings"
@@ -48,24 +50,51 @@ func GetCIDRsForASNNum(value string) ([]*net.IPNet, error) {
 
 // GetIPAddressesAsStream returns the chan of IP address for given ASN number
 // returning the string chan for optimizing the memory
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use GetIPAddressesSeq instead.
 func GetIPAddressesAsStream(value string) (chan string, error) {
-	cidrs, err := GetCIDRsForASNNum(value)
+	ips, err := GetIPAddressesSeq(value)
 	if err != nil {
 		return nil, err
 	}
 	ret := make(chan string)
 	go func() {
 		defer close(ret)
-		for _, cidr := range cidrs {
-			ips, _ := mapcidr.IPAddressesAsStream(cidr.String())
-			for ip := range ips {
-				ret <- ip
-			}
+		for ip := range ips {
+			ret <- ip
 		}
 	}()
 	return ret, nil
 }
 
+// GetIPAddressesSeq returns an iterator over the IP addresses for given ASN number
+func GetIPAddressesSeq(value string) (iter.Seq[string], error) {
+	cidrs, err := GetCIDRsForASNNum(value)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(string) bool) {
+		for _, cidr := range cidrs {
+			for ip := range mapcidr.IPAddressesSeq(cidr) {
+				if !yield(ip) {
+					return
+				}
+			}
+		}
+	}, nil
+}
+
+// GetIPAddressesSeqContext is like GetIPAddressesSeq but the iteration also
+// stops when ctx is done
+func GetIPAddressesSeqContext(ctx context.Context, value string) (iter.Seq[string], error) {
+	ips, err := GetIPAddressesSeq(value)
+	if err != nil {
+		return nil, err
+	}
+	return mapcidr.SeqWithContext(ctx, ips), nil
+}
+
 // IsASN checks if the given input is ASN or not,
 // its possible to have an domain name starting with AS/as prefix.
 func IsASN(value string) bool {
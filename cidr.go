@@ -2,37 +2,30 @@
 package mapcidr
 
 import (
+	"context"
 	"fmt"
+	"iter"
 	"math"
 	"math/big"
 	"net"
+	"slices"
 )
 
 // AddressRange returns the first and last addresses in the given CIDR range.
 func AddressRange(network *net.IPNet) (firstIP, lastIP net.IP, err error) {
-	firstIP = network.IP
-
-	prefixLen, bits := network.Mask.Size()
-	if prefixLen == bits {
-		lastIP := make([]byte, len(firstIP))
-		copy(lastIP, firstIP)
-		return firstIP, lastIP, nil
-	}
-
-	firstIPInt, bits, err := IPToInteger(firstIP)
-	if err != nil {
-		return nil, nil, err
+	prefix, ok := PrefixFromIPNet(network)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported IP address format")
 	}
-	hostLen := uint(bits) - uint(prefixLen)
-	lastIPInt := big.NewInt(1)
-	lastIPInt.Lsh(lastIPInt, hostLen)
-	lastIPInt.Sub(lastIPInt, big.NewInt(1))
-	lastIPInt.Or(lastIPInt, firstIPInt)
-	lastIP = IntegerToIP(lastIPInt, bits)
-	return
+	r := PrefixRange(prefix)
+	return r.First.AsSlice(), r.Last.AsSlice(), nil
 }
 
 // AddressCount returns the number of IP addresses in a range
+//
+// The count saturates at math.MaxUint64 for IPv6 CIDRs of /64 and larger,
+// whose 2^64 addresses or more don't fit in an uint64, use AddressCountBig to
+// get the exact value.
 func AddressCount(cidr string) (uint64, error) {
 	_, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
@@ -41,20 +34,35 @@ func AddressCount(cidr string) (uint64, error) {
 	return AddressCountIpnet(ipnet), nil
 }
 
+// AddressCountBig returns the exact number of IP addresses in a range
+func AddressCountBig(cidr string) (*big.Int, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return AddressCountIpnetBig(ipnet), nil
+}
+
 // AddressCountIpnet returns the number of IP addresses in an IPNet structure
 //
-// NOTE(dwisiswant0): This function uses uint64 and will overflow for IPv6 CIDRs
-// larger than /64 (e.g., /63, /48). Functions like SplitIPNetIntoN were
-// modified to work based on available prefix bits rather than the total address
-// count to avoid this overflow issue w/o requiring big.Int calcs for splitting.
-// But, direct usage of this function or functions relying on it
-// (like SplitIPNetByNumber) will still produce incorrect results for large IPv6
-// ranges.
+// The count saturates at math.MaxUint64 for IPv6 networks of /64 and larger,
+// whose 2^64 addresses or more don't fit in an uint64, use
+// AddressCountIpnetBig to get the exact value.
 func AddressCountIpnet(network *net.IPNet) uint64 {
 	prefixLen, bits := network.Mask.Size()
+	if bits-prefixLen >= 64 {
+		return math.MaxUint64
+	}
 	return 1 << (uint64(bits) - uint64(prefixLen))
 }
 
+// AddressCountIpnetBig returns the exact number of IP addresses in an IPNet
+// structure for both IPv4 and IPv6.
+func AddressCountIpnetBig(network *net.IPNet) *big.Int {
+	prefixLen, bits := network.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLen))
+}
+
 // SplitByNumber splits the given cidr into subnets with the closest
 // number of hosts per subnet.
 func SplitByNumber(iprange string, number int) ([]*net.IPNet, error) {
@@ -68,11 +76,15 @@ func SplitByNumber(iprange string, number int) ([]*net.IPNet, error) {
 // SplitIPNetByNumber splits an IPNet into subnets with the closest n
 // umber of hosts per subnet.
 func SplitIPNetByNumber(ipnet *net.IPNet, number int) ([]*net.IPNet, error) {
-	ipsNumber := AddressCountIpnet(ipnet)
-
-	// truncate result to nearest uint64
-	optimalSplit := int(ipsNumber / uint64(number))
-	return SplitIPNetIntoN(ipnet, optimalSplit)
+	prefix, ok := PrefixFromIPNet(ipnet)
+	if !ok {
+		return nil, fmt.Errorf("unsupported IP address format")
+	}
+	subnets, err := SplitPrefixByNumber(prefix, number)
+	if err != nil {
+		return nil, err
+	}
+	return IPNetsFromPrefixes(subnets), nil
 }
 
 // SplitN attempts to split a cidr in the exact number of subnets
@@ -86,194 +98,55 @@ func SplitN(iprange string, n int) ([]*net.IPNet, error) {
 
 // SplitIPNetIntoN attempts to split a ipnet in the exact number of subnets
 func SplitIPNetIntoN(iprange *net.IPNet, n int) ([]*net.IPNet, error) {
-	var err error
-	subnets := make([]*net.IPNet, 0, n)
-
-	prefixLen, bits := iprange.Mask.Size()
-	availableBits := bits - prefixLen
-	requiredBits := 0
-	if n > 1 {
-		requiredBits = int(math.Ceil(math.Log2(float64(n))))
-	}
-
-	// invalid value or impossible split
-	if n <= 1 || availableBits < requiredBits {
-		subnets = append(subnets, iprange)
-		return subnets, nil
-	}
-	// power of two
-	if isPowerOfTwo(n) { // isPowerOfTwoPlusOne(n)
-		return splitIPNet(iprange, n)
-	}
-
-	var closestMinorPowerOfTwo int
-	// find the closest power of two less than or equal to n
-	for i := n; i > 0; i-- {
-		if isPowerOfTwo(i) {
-			closestMinorPowerOfTwo = i
-			break
-		}
+	prefix, ok := PrefixFromIPNet(iprange)
+	if !ok {
+		return nil, fmt.Errorf("unsupported IP address format")
 	}
-
-	subnets, err = splitIPNet(iprange, closestMinorPowerOfTwo)
+	subnets, err := SplitPrefixIntoN(prefix, n)
 	if err != nil {
 		return nil, err
 	}
-	for len(subnets) < n {
-		lastSubnet := subnets[len(subnets)-1]
-
-		// NOTE(dwisiswant0): divide the last subnet into two
-		divided, err := divideIPNet(lastSubnet)
-		if err != nil {
-			// NOTE(dwisiswant0): This can happen if we try to split a /32 or /128
-			return nil, fmt.Errorf("cannot divide subnet %s further to reach %d splits: %w", lastSubnet, n, err)
-		}
-
-		subnets = subnets[:len(subnets)-1]
-		subnets = append(subnets, divided...)
-	}
-
-	return subnets, nil
+	return IPNetsFromPrefixes(subnets), nil
 }
 
-// divideIPNet divides an IPNet into two IPNet structures.
-func divideIPNet(ipnet *net.IPNet) ([]*net.IPNet, error) {
-	subnets := make([]*net.IPNet, 0, 2) //nolint
-
-	maskBits, _ := ipnet.Mask.Size()
-	wantedMaskBits := maskBits + 1
-
-	currentSubnet, err := currentSubnet(ipnet, wantedMaskBits)
-	if err != nil {
-		return nil, err
+// SplitIPNetIntoNBalanced splits a ipnet in n chunks whose address counts
+// differ by at most one, each chunk being the minimal list of subnets
+// covering it
+func SplitIPNetIntoNBalanced(iprange *net.IPNet, n int) ([][]*net.IPNet, error) {
+	prefix, ok := PrefixFromIPNet(iprange)
+	if !ok {
+		return nil, fmt.Errorf("unsupported IP address format")
 	}
-	subnets = append(subnets, currentSubnet)
-	nextSubnet, err := nextSubnet(currentSubnet, wantedMaskBits)
+	chunks, err := SplitPrefixBalanced(prefix, n)
 	if err != nil {
 		return nil, err
 	}
-	subnets = append(subnets, nextSubnet)
-
-	return subnets, nil
-}
-
-// splitIPNet into approximate N counts
-func splitIPNet(ipnet *net.IPNet, n int) ([]*net.IPNet, error) {
-	var err error
-	subnets := make([]*net.IPNet, 0, n)
-
-	maskBits, _ := ipnet.Mask.Size()
-	closestPow2 := int(closestPowerOfTwo(uint32(n)))
-	pow2 := int(math.Log2(float64(closestPow2)))
-
-	wantedMaskBits := maskBits + pow2
-
-	currentSubnet, err := currentSubnet(ipnet, wantedMaskBits)
-	if err != nil {
-		return nil, err
-	}
-	subnets = append(subnets, currentSubnet)
-	nxtSubnet := currentSubnet
-	for i := 0; i < closestPow2-1; i++ {
-		nxtSubnet, err = nextSubnet(nxtSubnet, wantedMaskBits)
-		if err != nil {
-			return nil, err
-		}
-		subnets = append(subnets, nxtSubnet)
-	}
-
-	if len(subnets) < n {
-		lastSubnet := subnets[len(subnets)-1]
-		subnets = subnets[:len(subnets)-1]
-		ipnets, err := divideIPNet(lastSubnet)
-		if err != nil {
-			return nil, err
-		}
-		subnets = append(subnets, ipnets...)
+	subnets := make([][]*net.IPNet, 0, len(chunks))
+	for _, chunk := range chunks {
+		subnets = append(subnets, IPNetsFromPrefixes(chunk.Prefixes()))
 	}
 	return subnets, nil
 }
 
-// func split(iprange string, n int) ([]*net.IPNet, error) {
-// 	_, ipnet, _ := net.ParseCIDR(iprange)
-// 	return splitIPNet(ipnet, n)
-// }
-
-func nextPowerOfTwo(v uint32) uint32 {
-	v--
-	v |= v >> 1
-	v |= v >> 2
-	v |= v >> 4
-	v |= v >> 8
-	v |= v >> 16
-	v++
-	return v
-}
-
-func closestPowerOfTwo(v uint32) uint32 {
-	next := nextPowerOfTwo(v)
-	if prev := next / 2; (v - prev) < (next - v) {
-		next = prev
-	}
-	return next
-}
-
-func currentSubnet(network *net.IPNet, prefixLen int) (*net.IPNet, error) {
-	currentFirst, _, err := AddressRange(network)
-	if err != nil {
-		return nil, err
-	}
-	mask := net.CIDRMask(prefixLen, 8*len(currentFirst)) //nolint
-	return &net.IPNet{IP: currentFirst.Mask(mask), Mask: mask}, nil
-}
-
-// nextSubnet returns the next subnet for an ipnet
-func nextSubnet(network *net.IPNet, prefixLen int) (*net.IPNet, error) {
-	_, currentLast, err := AddressRange(network)
-	if err != nil {
-		return nil, err
+// SplitIPNetByRatio splits a ipnet in one part per weight, with sizes
+// proportional to the weights (e.g. 3:1), each part being the minimal list
+// of subnets covering it
+func SplitIPNetByRatio(iprange *net.IPNet, weights []int) ([][]*net.IPNet, error) {
+	prefix, ok := PrefixFromIPNet(iprange)
+	if !ok {
+		return nil, fmt.Errorf("unsupported IP address format")
 	}
-	mask := net.CIDRMask(prefixLen, 8*len(currentLast)) //nolint
-	currentSubnet := &net.IPNet{IP: currentLast.Mask(mask), Mask: mask}
-	_, last, err := AddressRange(currentSubnet)
+	parts, err := SplitPrefixByRatio(prefix, weights, 0)
 	if err != nil {
 		return nil, err
 	}
-	last = inc(last)
-	next := &net.IPNet{IP: last.Mask(mask), Mask: mask}
-	if last.Equal(net.IPv4zero) || last.Equal(net.IPv6zero) {
-		return next, nil
+	subnets := make([][]*net.IPNet, 0, len(parts))
+	for _, part := range parts {
+		subnets = append(subnets, IPNetsFromPrefixes(part))
 	}
-	return next, nil
-}
-
-// isPowerOfTwoPlusOne returns if a number is a power of 2 plus 1
-//
-// NOTE(dwisiswant0): This function is no longer used. The logic in
-// SplitIPNetIntoN was refactored to correctly handle non-power-of-two splits by
-// first splitting into the largest power-of-two less than or equal to n, and
-// then iteratively dividing the last subnet. This removed the need for this
-// specific check.
-//
-// nolint:all
-// func isPowerOfTwoPlusOne(x int) bool {
-// 	return isPowerOfTwo(x - 1)
-// }
-
-// isPowerOfTwo returns if a number is a power of 2
-func isPowerOfTwo(x int) bool {
-	return x != 0 && (x&(x-1)) == 0
+	return subnets, nil
 }
 
-// reverseIPNet reverses an ipnet slice
-//
-// nolint:all
-// func reverseIPNet(ipnets []*net.IPNet) {
-// 	for i, j := 0, len(ipnets)-1; i < j; i, j = i+1, j-1 {
-// 		ipnets[i], ipnets[j] = ipnets[j], ipnets[i]
-// 	}
-// }
-
 // IPAddresses returns all the IP addresses in a CIDR
 func IPAddresses(cidr string) ([]string, error) {
 	_, ipnet, err := net.ParseCIDR(cidr)
@@ -283,6 +156,10 @@ func IPAddresses(cidr string) ([]string, error) {
 	return IPAddressesIPnet(ipnet), nil
 }
 
+// IPAddressesAsStream returns all the IP addresses in a CIDR as a channel.
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use IPAddressesSeq instead.
 func IPAddressesAsStream(cidr string) (chan string, error) {
 	_, ipnet, err := net.ParseCIDR(cidr)
 	if err != nil {
@@ -293,27 +170,36 @@ func IPAddressesAsStream(cidr string) (chan string, error) {
 
 // IPAddressesIPnet returns all IP addresses in an IPNet.
 func IPAddressesIPnet(ipnet *net.IPNet) (ips []string) {
-	for ip := range IpAddresses(ipnet) {
-		ips = append(ips, ip)
-	}
-	return ips
+	return slices.Collect(IPAddressesSeq(ipnet))
 }
 
 // IpAddresses as stream
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use IPAddressesSeq instead.
 func IpAddresses(ipnet *net.IPNet) (ips chan string) {
-	ips = make(chan string)
-	go func() {
-		defer close(ips)
+	return seqToChan(IPAddressesSeq(ipnet))
+}
 
-		netWithRange := ipNetToRange(*ipnet)
-		for ip := *netWithRange.First; !ip.Equal(*netWithRange.Last); ip = GetNextIP(ip) {
-			ips <- ip.String()
+// IPAddressesSeq returns an iterator over all the IP addresses in an IPNet.
+// Breaking out of the loop stops the enumeration.
+func IPAddressesSeq(ipnet *net.IPNet) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		prefix, ok := PrefixFromIPNet(ipnet)
+		if !ok {
+			return
+		}
+		for addr := range PrefixAddrsSeq(prefix) {
+			if !yield(addr.String()) {
+				return
+			}
 		}
+	}
+}
 
-		// Add the last IP
-		ips <- netWithRange.Last.String()
-	}()
-	return ips
+// IPAddressesSeqContext is like IPAddressesSeq but also stops when ctx is done.
+func IPAddressesSeqContext(ctx context.Context, ipnet *net.IPNet) iter.Seq[string] {
+	return SeqWithContext(ctx, IPAddressesSeq(ipnet))
 }
 
 // IPToInteger converts an IP address to its integer representation.
@@ -1,7 +1,9 @@
 package mapcidr
 
 import (
+	"math"
 	"net"
+	"net/netip"
 	"reflect"
 	"testing"
 )
@@ -116,3 +118,127 @@ func TestSplitIPNetIntoN(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitIPNetIntoNBalanced(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.0/29")
+	chunks, err := SplitIPNetIntoNBalanced(ipnet, 3)
+	if err != nil {
+		t.Fatalf("SplitIPNetIntoNBalanced() error = %v", err)
+	}
+	var got [][]string
+	for _, chunk := range chunks {
+		var subnets []string
+		for _, subnet := range chunk {
+			subnets = append(subnets, subnet.String())
+		}
+		got = append(got, subnets)
+	}
+	want := [][]string{{"192.168.0.0/31", "192.168.0.2/32"}, {"192.168.0.3/32", "192.168.0.4/31"}, {"192.168.0.6/31"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitIPNetIntoNBalanced() got = %v, want %v", got, want)
+	}
+
+	if _, err := SplitIPNetIntoNBalanced(ipnet, 9); err == nil {
+		t.Errorf("SplitIPNetIntoNBalanced() expected an error splitting 8 addresses into 9 chunks")
+	}
+}
+
+func TestSplitIPNetByRatio(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/16")
+	parts, err := SplitIPNetByRatio(ipnet, []int{50, 25, 25})
+	if err != nil {
+		t.Fatalf("SplitIPNetByRatio() error = %v", err)
+	}
+	var got [][]string
+	for _, part := range parts {
+		var subnets []string
+		for _, subnet := range part {
+			subnets = append(subnets, subnet.String())
+		}
+		got = append(got, subnets)
+	}
+	want := [][]string{{"10.0.0.0/17"}, {"10.0.128.0/18"}, {"10.0.192.0/18"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitIPNetByRatio() got = %v, want %v", got, want)
+	}
+}
+
+func TestAddressCountIpnetBig(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"192.168.1.0/24", "256"},
+		{"2001:db8::/64", "18446744073709551616"},
+		{"2001:db8::/48", "1208925819614629174706176"},
+		{"::/0", "340282366920938463463374607431768211456"},
+	}
+	for _, tt := range tests {
+		got, err := AddressCountBig(tt.cidr)
+		if err != nil {
+			t.Fatalf("Failed to count %s: %v", tt.cidr, err)
+		}
+		if got.String() != tt.want {
+			t.Errorf("AddressCountBig(%s) got = %s, want %s", tt.cidr, got, tt.want)
+		}
+	}
+
+	_, ipnet, _ := net.ParseCIDR("2001:db8::/48")
+	if got := AddressCountIpnet(ipnet); got != math.MaxUint64 {
+		t.Errorf("AddressCountIpnet() got = %d, want saturated count", got)
+	}
+
+	// a /64 has 2^64 addresses, one more than the largest uint64
+	for _, tt := range []struct {
+		cidr string
+		want uint64
+	}{
+		{"2001:db8::/64", math.MaxUint64},
+		{"2001:db8::/65", 1 << 63},
+	} {
+		got, err := AddressCount(tt.cidr)
+		if err != nil {
+			t.Fatalf("Failed to count %s: %v", tt.cidr, err)
+		}
+		if got != tt.want {
+			t.Errorf("AddressCount(%s) got = %d, want %d", tt.cidr, got, tt.want)
+		}
+	}
+}
+
+func TestSplitIPNetByNumberIPv6(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("2001:db8::/112")
+	gotNets, err := SplitIPNetByNumber(ipnet, 16384)
+	if err != nil {
+		t.Fatalf("SplitIPNetByNumber() error = %v", err)
+	}
+	var got []string
+	for _, n := range gotNets {
+		got = append(got, n.String())
+	}
+	want := []string{"2001:db8::/114", "2001:db8::4000/114", "2001:db8::8000/114", "2001:db8::c000/114"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitIPNetByNumber() got = %v, want %v", got, want)
+	}
+
+	// 2^64 subnets of 65536 hosts can only be streamed
+	_, ipnet, _ = net.ParseCIDR("2001:db8::/48")
+	if _, err := SplitIPNetByNumber(ipnet, 65536); err == nil {
+		t.Errorf("SplitIPNetByNumber() expected an error for too many subnets")
+	}
+	subnets, err := SplitPrefixByNumberSeq(netip.MustParsePrefix("2001:db8::/48"), 65536)
+	if err != nil {
+		t.Fatalf("SplitPrefixByNumberSeq() error = %v", err)
+	}
+	got = got[:0]
+	for subnet := range subnets {
+		got = append(got, subnet.String())
+		if len(got) == 3 {
+			break
+		}
+	}
+	want = []string{"2001:db8::/112", "2001:db8::1:0/112", "2001:db8::2:0/112"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitPrefixByNumberSeq() got = %v, want %v", got, want)
+	}
+}
@@ -32,6 +32,7 @@ var mapcidrTestcases = map[string]TestCase{
 	"Multiple CIDR Expansion":              &mapCidrQuery{question: "192.168.0.0/30,10.50.0.0/30", expectedOutput: []string{"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3", "10.50.0.0", "10.50.0.1", "10.50.0.2", "10.50.0.3"}},
 	"Slice CIDRs by given CIDR count":      &mapCidrQuery{question: "173.0.84.0/24", expectedOutput: []string{"173.0.84.0/27", "173.0.84.32/27", "173.0.84.64/27", "173.0.84.96/27", "173.0.84.128/27", "173.0.84.160/27", "173.0.84.192/27", "173.0.84.224/28", "173.0.84.240/29", "173.0.84.248/29"}, args: "-sbc 10"},
 	"Slice CIDRs by given host count":      &mapCidrQuery{question: "173.0.0.0/16", expectedOutput: []string{"173.0.0.0/17", "173.0.128.0/18", "173.0.192.0/18"}, args: "-sbh 20000"},
+	"Slice IPv6 CIDRs by given host count": &mapCidrQuery{question: "2001:db8::/120", expectedOutput: []string{"2001:db8::/122", "2001:db8::40/122", "2001:db8::80/122", "2001:db8::c0/122"}, args: "-sbh 64"},
 	"CIDR Aggregation":                     &mapCidrQuery{question: "173.0.0.0/18,173.0.64.0/18,173.0.128.0/18,173.0.192.0/18", expectedOutput: []string{"173.0.0.0/16"}, args: "-a"},
 	"CIDR Aggregation(file)":               &mapCidrQuery{question: "", expectedOutput: []string{"173.0.0.0/16"}, args: "-cl ./tests/cidrs_a.txt -a"},
 	"CIDR Aggregation with comments":       &mapCidrQuery{question: "173.0.0.0/18 #sample,173.0.64.0/18  #sample two spaces,173.0.128.0/18#no space,173.0.192.0/18", expectedOutput: []string{"173.0.0.0/16"}, args: "-a"},
@@ -46,15 +47,44 @@ var mapcidrTestcases = map[string]TestCase{
 	"Filter IP IPv6":                       &mapCidrQuery{question: "2001:db8::/126", expectedOutput: []string{"2001:db8::", "2001:db8::1", "2001:db8::3"}, args: "-fi 2001:db8::2"},
 	"Convert IPs to IPv6":                  &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{"00:00:00:00:00:ffff:c0a8:0000", "00:00:00:00:00:ffff:c0a8:0001", "00:00:00:00:00:ffff:c0a8:0002", "00:00:00:00:00:ffff:c0a8:0003"}, args: "-t6"},
 	"CIDR Skip Base":                       &mapCidrQuery{question: "192.168.1.0/30", expectedOutput: []string{"192.168.1.1", "192.168.1.2", "192.168.1.3"}, args: "-skip-base"},
+	"CIDR Skip Broadcast Subnet":           &mapCidrQuery{question: "192.168.1.0/25", expectedOutput: []string{"127"}, args: "-skip-broadcast -count"},
+	"CIDR Skip Ends":                       &mapCidrQuery{question: "192.168.1.0/29", expectedOutput: []string{"192.168.1.2", "192.168.1.3", "192.168.1.4", "192.168.1.5"}, args: "-skip-ends 2"},
 	"CIDR Skip Broadcast":                  &mapCidrQuery{question: "192.168.0.255/30", expectedOutput: []string{"192.168.0.252", "192.168.0.253", "192.168.0.254"}, args: "-skip-broadcast"},
 	"CIDR Sort (ascending order)":          &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3"}, args: "-s"},
 	"CIDR Reverse Sort (descending order)": &mapCidrQuery{question: "10.40.1.0/30", expectedOutput: []string{"10.40.1.3", "10.40.1.2", "10.40.1.1", "10.40.1.0"}, args: "-sr"},
 	"CIDR Shuffle IPs":                     &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{"192.168.0.3", "192.168.0.0", "192.168.0.1", "192.168.0.2"}, args: "-si"},
 	"CIDR Shuffle Port IPs":                &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{"192.168.0.3:8080", "192.168.0.0:8080", "192.168.0.1:8080", "192.168.0.2:8080"}, args: "-sp 8080"},
 	"CIDR Shuffle Multiple Port IPs":       &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{"192.168.0.3:8080", "192.168.0.0:8080", "192.168.0.1:8080", "192.168.0.2:8080", "192.168.0.3:9090", "192.168.0.0:9090", "192.168.0.1:9090", "192.168.0.2:9090"}, args: "-sp 8080,9090"},
+	"CIDR Shuffle IPv6 IPs":                &mapCidrQuery{question: "2001:db8::/126,10.0.0.0/31", expectedOutput: []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3", "10.0.0.0", "10.0.0.1"}, args: "-si"},
+	"CIDR Shuffle IPv6 Port IPs":           &mapCidrQuery{question: "2001:db8::/127", expectedOutput: []string{"[2001:db8::]:80", "[2001:db8::1]:80", "[2001:db8::]:443", "[2001:db8::1]:443"}, args: "-sp 80,443"},
+	"CIDR Shuffle First Shard":             &mapCidrQuery{question: "10.0.0.0/30", expectedOutput: []string{"10.0.0.2", "10.0.0.1"}, args: "-si -seed 5 -shard 1/2"},
+	"CIDR Shuffle Second Shard":            &mapCidrQuery{question: "10.0.0.0/30", expectedOutput: []string{"10.0.0.3", "10.0.0.0"}, args: "-si -seed 5 -shard 2/2"},
+	"CIDR Shuffle Port IPs With Filter":    &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{"192.168.0.0:80", "192.168.0.2:80", "192.168.0.2:443", "192.168.0.3:80", "192.168.0.3:443"}, args: "-sp 80,443 -fi 192.168.0.1,192.168.0.0:443"},
+	"CIDR Shuffle Port Ranges":             &mapCidrQuery{question: "192.168.0.0/31", expectedOutput: []string{"192.168.0.0:22", "192.168.0.0:8000", "192.168.0.0:8002", "192.168.0.1:22", "192.168.0.1:8000", "192.168.0.1:8002"}, args: "-sp ssh,8000-8002,!8001"},
+	"CIDR Shuffle Per Target Ports":        &mapCidrQuery{question: "192.168.0.0/31:80,443", expectedOutput: []string{"192.168.0.0:80", "192.168.0.0:443", "192.168.0.1:80", "192.168.0.1:443"}, args: "-si"},
+	"CIDR Slice By Prefix Length":          &mapCidrQuery{question: "173.0.84.0/22", expectedOutput: []string{"173.0.84.0/24", "173.0.85.0/24", "173.0.86.0/24", "173.0.87.0/24"}, args: "-sbp 24"},
+	"CIDR Slice By Count Balanced":         &mapCidrQuery{question: "192.168.0.0/29", expectedOutput: []string{"192.168.0.0/31,192.168.0.2/32", "192.168.0.3/32,192.168.0.4/31", "192.168.0.6/31"}, args: "-sbc 3 -balanced"},
+	"CIDR Slice By Ratio":                  &mapCidrQuery{question: "10.0.0.0/16", expectedOutput: []string{"10.0.0.0/17,10.0.128.0/18", "10.0.192.0/18"}, args: "-sbr 3:1"},
+	"Subnet Parent":                        &mapCidrQuery{question: "192.168.3.0/24", expectedOutput: []string{"192.168.0.0/16"}, args: "-parent 16"},
+	"Subnet Sibling":                       &mapCidrQuery{question: "192.168.3.0/24", expectedOutput: []string{"192.168.2.0/24"}, args: "-sibling"},
+	"Subnet Next Previous":                 &mapCidrQuery{question: "192.168.3.0/24", expectedOutput: []string{"192.168.2.0/24", "192.168.4.0/24", "192.168.5.0/24"}, args: "-next 2 -previous 1"},
+	"Free Space":                           &mapCidrQuery{question: "192.168.0.0/22", expectedOutput: []string{"192.168.1.0/24", "192.168.2.0/23"}, args: "-free 192.168.0.0/24"},
+	"Next Free Subnet":                     &mapCidrQuery{question: "192.168.0.0/22", expectedOutput: []string{"192.168.2.0/23"}, args: "-gaps 192.168.0.0/24 -next-free 23"},
+	"Subnet Info":                          &mapCidrQuery{question: "192.168.0.1/30", expectedOutput: []string{"Address:         192.168.0.1", "Network:         192.168.0.0/30", "Netmask:         255.255.255.252 = 30", "Wildcard:        0.0.0.3", "Broadcast:       192.168.0.3", "HostMin:         192.168.0.1", "HostMax:         192.168.0.2", "Hosts:           2", "Addresses:       4", "Binary:          11000000.10101000.00000000.000000 00", "Class:           C", "Address space:   Private-Use", "Reverse zone:    0.168.192.in-addr.arpa"}, args: "-info"},
+	"Subnet Info JSON":                     &mapCidrQuery{question: "192.168.0.0/30", expectedOutput: []string{`{"address":"192.168.0.0","prefix":"192.168.0.0/30","version":4,"netmask":"255.255.255.252","wildcard":"0.0.0.3","network":"192.168.0.0","broadcast":"192.168.0.3","first_host":"192.168.0.1","last_host":"192.168.0.2","addresses":4,"hosts":2,"binary":"11000000.10101000.00000000.000000 00","class":"C","address_space":"Private-Use","reverse_zone":"0.168.192.in-addr.arpa"}`}, args: "-info -json"},
+	"Netmask Input":                        &mapCidrQuery{question: "192.168.1.0 255.255.255.252", expectedOutput: []string{"192.168.1.0", "192.168.1.1", "192.168.1.2", "192.168.1.3"}},
+	"Wildcard Input":                       &mapCidrQuery{question: "10.0.0.0/0.0.255.255", expectedOutput: []string{"10.0.0.0/16"}, args: "-aggregate"},
+	"Netmask Output":                       &mapCidrQuery{question: "10.0.0.0/23", expectedOutput: []string{"10.0.0.0 255.255.255.0", "10.0.1.0 255.255.255.0"}, args: "-sbc 2 -notation netmask"},
+	"Wildcard Output":                      &mapCidrQuery{question: "10.0.0.0/16", expectedOutput: []string{"10.0.0.0 0.0.255.255"}, args: "-aggregate -notation wildcard"},
+	"Exclude Private":                      &mapCidrQuery{question: "10.0.0.0/7", expectedOutput: []string{"11.0.0.0/8"}, args: "-exclude-private -aggregate"},
+	"Only Public":                          &mapCidrQuery{question: "192.0.2.0/23", expectedOutput: []string{"256"}, args: "-only-public -count"},
+	"Partition Inputs":                     &mapCidrQuery{question: "192.168.0.0/30,192.168.0.4/30", expectedOutput: []string{"1 192.168.0.0/30", "2 192.168.0.4/30"}, args: "-partition 2"},
+	"Partition Netmask Output":             &mapCidrQuery{question: "192.168.0.0/30,192.168.0.4/30", expectedOutput: []string{"1 192.168.0.0 255.255.255.252", "2 192.168.0.4 255.255.255.252"}, args: "-partition 2 -notation netmask"},
 
 	//IP range
 	"IPRange Expansion":                       &mapCidrQuery{question: "192.168.0.0-192.168.0.3", expectedOutput: []string{"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3"}},
+	"IPRange Spaced Expansion":                &mapCidrQuery{question: "192.168.0.1 - 192.168.0.3", expectedOutput: []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"}},
+	"IPRange Spaced Last Octet Expansion":     &mapCidrQuery{question: "192.168.0.1 - 3", expectedOutput: []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"}},
 	"Multiple IPRange Expansion":              &mapCidrQuery{question: "192.168.0.0-192.168.0.3,192.168.0.4-192.168.0.10", expectedOutput: []string{"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3", "192.168.0.4", "192.168.0.5", "192.168.0.6", "192.168.0.7", "192.168.0.8", "192.168.0.9", "192.168.0.10"}},
 	"IPRange Aggregation":                     &mapCidrQuery{question: "192.168.0.0-192.168.0.3", expectedOutput: []string{"192.168.0.0/30"}, args: "-a"},
 	"Multiple IPRange Aggregation":            &mapCidrQuery{question: "192.168.0.0-192.168.0.128,192.168.0.129-192.168.0.255", expectedOutput: []string{"192.168.0.0/24"}, args: "-a"},
@@ -71,6 +101,8 @@ var mapcidrTestcases = map[string]TestCase{
 	"IPRange Shuffle IPs":                     &mapCidrQuery{question: "192.168.0.0-192.168.0.3", expectedOutput: []string{"192.168.0.3", "192.168.0.0", "192.168.0.1", "192.168.0.2"}, args: "-si"},
 	"IPRange Shuffle Port IPs":                &mapCidrQuery{question: "173.0.0.0-173.0.0.3", expectedOutput: []string{"173.0.0.3:8080", "173.0.0.0:8080", "173.0.0.1:8080", "173.0.0.2:8080"}, args: "-sp 8080"},
 	"IPRange Shuffle Multiple Port IPs":       &mapCidrQuery{question: "192.168.0.0-192.168.0.3", expectedOutput: []string{"192.168.0.3:8080", "192.168.0.0:8080", "192.168.0.1:8080", "192.168.0.2:8080", "192.168.0.3:9090", "192.168.0.0:9090", "192.168.0.1:9090", "192.168.0.2:9090"}, args: "-sp 8080,9090"},
+	"IPv6 Range Shorthand Expansion":          &mapCidrQuery{question: "2001:db8::1-3", expectedOutput: []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+	"IPRange With Spaces Aggregation":         &mapCidrQuery{question: "192.168.0.0 - 192.168.0.255", expectedOutput: []string{"192.168.0.0/24"}, args: "-a"},
 
 	// sort IPs from file
 	"IPs Sort (ascending order)":  &mapCidrQuery{question: "", expectedOutput: []string{"1.1.1.1", "2.2.2.2", "2.4.3.2", "2.4.4.4", "8.8.8.8", "9.9.9.9", "255.255.255.255"}, args: "-cl ./tests/ips_sort.txt -s"},
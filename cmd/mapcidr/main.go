@@ -3,14 +3,21 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
 	"net"
+	"net/netip"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/projectdiscovery/goflags"
@@ -42,16 +49,37 @@ func init() {
 type Options struct {
 	Slices                int
 	HostCount             int
+	Balanced              bool
+	SplitRatio            string
+	SplitPrefix           int
+	SplitLimit            int
+	Partition             int
+	PartitionWeights      string
+	Parent                int
+	Sibling               bool
+	Next                  int
+	Previous              int
+	VLSM                  string
+	Free                  goflags.StringSlice
+	NextFree              int
+	Info                  bool
+	JSON                  bool
 	FileCidr              goflags.StringSlice
 	Silent                bool
 	Verbose               bool
 	Version               bool
 	Output                string
+	Notation              string
 	Aggregate             bool
 	Shuffle               bool
 	ShufflePorts          string
+	Seed                  int64
+	Resume                string
+	CheckpointInterval    time.Duration
+	Shard                 string
 	SkipBaseIP            bool
 	SkipBroadcastIP       bool
+	SkipEnds              int
 	AggregateApprox       bool
 	SortAscending         bool
 	SortDescending        bool
@@ -63,6 +91,10 @@ type Options struct {
 	ToIP6                 bool
 	MatchIP               goflags.StringSlice
 	FilterIP              goflags.StringSlice
+	ExcludePrivate        bool
+	ExcludeReserved       bool
+	ExcludeBogons         bool
+	OnlyPublic            bool
 	IPFormats             goflags.StringSlice
 	ZeroPadNumberOfZeroes int
 	ZeroPadPermute        bool
@@ -118,6 +150,20 @@ func ParseOptions() *Options {
 	flagSet.CreateGroup("process", "Process",
 		flagSet.IntVar(&options.Slices, "sbc", 0, "Slice CIDRs by given CIDR count"),
 		flagSet.IntVar(&options.HostCount, "sbh", 0, "Slice CIDRs by given HOST count"),
+		flagSet.BoolVarP(&options.Balanced, "balanced", "sbb", false, "Slice CIDRs by -sbc into chunks with the same number of IPs (one chunk per line)"),
+		flagSet.StringVarP(&options.SplitRatio, "split-ratio", "sbr", "", "Slice CIDRs into parts proportional to given weights (e.g. 3:1 or 50,25,25), with subnets no smaller than -sbp (one part per line)"),
+		flagSet.IntVarP(&options.SplitPrefix, "split-prefix", "sbp", 0, "Slice CIDRs into subnets of given prefix length (e.g. 24)"),
+		flagSet.IntVarP(&options.SplitLimit, "split-limit", "sl", 1<<24, "Maximum number of subnets a CIDR can be sliced into by prefix length (0 for no limit)"),
+		flagSet.IntVarP(&options.Partition, "partition", "pn", 0, "Partition all input IPs/CIDRs into given number of groups with the same number of IPs"),
+		flagSet.StringVarP(&options.PartitionWeights, "partition-weights", "pw", "", "Weights of the partition groups (e.g. 2,1,1), one group per weight"),
+		flagSet.IntVar(&options.Parent, "parent", 0, "Output the parent subnet of given prefix length of each CIDR (e.g. 16)"),
+		flagSet.BoolVar(&options.Sibling, "sibling", false, "Output the sibling subnet of each CIDR (the other half of its parent)"),
+		flagSet.IntVar(&options.Next, "next", 0, "Output given number of subnets of the same size following each CIDR"),
+		flagSet.IntVar(&options.Previous, "previous", 0, "Output given number of subnets of the same size preceding each CIDR"),
+		flagSet.StringVar(&options.VLSM, "vlsm", "", "File with the subnets to allocate in each CIDR, one 'name hosts' per line (e.g. web 500)"),
+		flagSet.StringSliceVarP(&options.Free, "free", "gaps", nil, "IP/CIDR/FILE containing list of used IP/CIDR to output the free space of input CIDRs from (comma-separated, file input)", goflags.FileNormalizedStringSliceOptions),
+		flagSet.IntVarP(&options.NextFree, "next-free", "nf", 0, "Output the first free subnet of given prefix length in input CIDRs"),
+		flagSet.BoolVar(&options.Info, "info", false, "Output the netmask, wildcard, network, broadcast, hosts, binary, class and reverse zone of each CIDR"),
 		flagSet.BoolVarP(&options.Aggregate, "aggregate", "a", false, "Aggregate IPs/CIDRs into minimum subnet"),
 		flagSet.BoolVarP(&options.AggregateApprox, "aggregate-approx", "aa", false, "Aggregate sparse IPs/CIDRs into minimum approximated subnet"),
 		flagSet.BoolVarP(&options.Count, "count", "c", false, "Count number of IPs in given CIDR"),
@@ -132,17 +178,26 @@ func ParseOptions() *Options {
 	flagSet.CreateGroup("filter", "Filter",
 		flagSet.BoolVarP(&options.FilterIP4, "filter-ipv4", "f4", false, "Filter IPv4 IPs from input"),
 		flagSet.BoolVarP(&options.FilterIP6, "filter-ipv6", "f6", false, "Filter IPv6 IPs from input"),
-		flagSet.BoolVar(&options.SkipBaseIP, "skip-base", false, "Skip base IPs (ending in .0) in output"),
-		flagSet.BoolVar(&options.SkipBroadcastIP, "skip-broadcast", false, "Skip broadcast IPs (ending in .255) in output"),
+		flagSet.BoolVar(&options.SkipBaseIP, "skip-base", false, "Skip the network IP of each input subnet in output (not for /31 and /32)"),
+		flagSet.BoolVar(&options.SkipBroadcastIP, "skip-broadcast", false, "Skip the broadcast IP of each input subnet in output (not for /31 and /32)"),
+		flagSet.IntVarP(&options.SkipEnds, "skip-ends", "se", 0, "Skip given number of IPs at each end of every input subnet in output (not for /31 and /32)"),
 		flagSet.StringSliceVarP(&options.MatchIP, "match-ip", "mi", nil, "IP/CIDR/FILE containing list of IP/CIDR to match (comma-separated, file input)", goflags.FileNormalizedStringSliceOptions),
 		flagSet.StringSliceVarP(&options.FilterIP, "filter-ip", "fi", nil, "IP/CIDR/FILE containing list of IP/CIDR to filter (comma-separated, file input)", goflags.FileNormalizedStringSliceOptions),
+		flagSet.BoolVarP(&options.ExcludePrivate, "exclude-private", "ep", false, "Exclude private IPs from input (RFC 1918, CGNAT and IPv6 ULA)"),
+		flagSet.BoolVarP(&options.ExcludeReserved, "exclude-reserved", "er", false, "Exclude reserved IPs from input (loopback, link-local, multicast, documentation, benchmarking and IANA reserved)"),
+		flagSet.BoolVarP(&options.ExcludeBogons, "exclude-bogons", "eb", false, "Exclude IPs not globally reachable from input, as per the IANA special-purpose registries"),
+		flagSet.BoolVarP(&options.OnlyPublic, "only-public", "op", false, "Keep only global unicast IPs from input"),
 	)
 
 	flagSet.CreateGroup("miscellaneous", "Miscellaneous",
 		flagSet.BoolVarP(&options.SortAscending, "sort", "s", false, "Sort input IPs in ascending order"),
 		flagSet.BoolVarP(&options.SortDescending, "sort-reverse", "sr", false, "Sort input IPs in descending order"),
 		flagSet.BoolVarP(&options.Shuffle, "shuffle-ip", "si", false, "Shuffle Input IPs in random order"),
-		flagSet.StringVarP(&options.ShufflePorts, "shuffle-port", "sp", "", "Shuffle Input IP:Port in random order"),
+		flagSet.StringVarP(&options.ShufflePorts, "shuffle-port", "sp", "", "Shuffle Input IP:Port in random order (ports, ranges, service names, top-100, top-1000, !excluded)"),
+		flagSet.Int64Var(&options.Seed, "seed", 0, "Seed of the shuffled order (default current time)"),
+		flagSet.StringVar(&options.Resume, "resume", "", "File to resume the shuffled order from and to save its progress to"),
+		flagSet.DurationVarP(&options.CheckpointInterval, "checkpoint-interval", "ci", 10*time.Second, "Interval between progress saves to the resume file"),
+		flagSet.StringVar(&options.Shard, "shard", "", "Shard of the shuffled targets to output, as i/n (e.g. 1/3), for workers sharing a seed"),
 	)
 
 	flagSet.CreateGroup("update", "Update",
@@ -153,6 +208,8 @@ func ParseOptions() *Options {
 	flagSet.CreateGroup("output", "Output",
 		flagSet.BoolVar(&options.Verbose, "verbose", false, "Verbose mode"),
 		flagSet.StringVarP(&options.Output, "output", "o", "", "File to write output to"),
+		flagSet.BoolVarP(&options.JSON, "json", "j", false, "Write subnet information in JSON lines format (-info)"),
+		flagSet.StringVarP(&options.Notation, "notation", "nt", "", "Notation of the output IPv4 CIDRs (cidr, netmask, wildcard)"),
 		flagSet.BoolVar(&options.Silent, "silent", false, "Silent mode"),
 		flagSet.BoolVar(&options.Version, "version", false, "Show version of the project"),
 	)
@@ -222,6 +279,80 @@ func (options *Options) validateOptions() error {
 		return errors.New("sbc and sbh can't be used together")
 	}
 
+	if options.Balanced && options.Slices <= 0 {
+		return errors.New("balanced can only be used with sbc")
+	}
+
+	if options.SplitPrefix > 0 && (options.Slices > 0 || options.HostCount > 0) {
+		return errors.New("sbp can't be used with sbc or sbh")
+	}
+
+	if options.SplitRatio != "" {
+		if options.Slices > 0 || options.HostCount > 0 {
+			return errors.New("sbr can't be used with sbc or sbh")
+		}
+		if _, err := parseWeights(options.SplitRatio); err != nil {
+			return err
+		}
+	}
+
+	if options.PartitionWeights != "" {
+		weights, err := parseWeights(options.PartitionWeights)
+		if err != nil {
+			return err
+		}
+		if options.Partition > 0 && options.Partition != len(weights) {
+			return errors.New("the number of partition weights must match the number of groups")
+		}
+	}
+
+	if options.Parent < 0 || options.Parent > 128 {
+		return fmt.Errorf("invalid parent prefix length %d", options.Parent)
+	}
+
+	if options.Next < 0 || options.Previous < 0 {
+		return errors.New("next and previous must be positive")
+	}
+
+	if options.hasNavigation() && (options.Slices > 0 || options.HostCount > 0 || options.SplitPrefix > 0 || options.SplitRatio != "") {
+		return errors.New("parent, sibling, next and previous can't be used with sbc, sbh, sbp or sbr")
+	}
+
+	if options.VLSM != "" {
+		if options.hasNavigation() || options.Slices > 0 || options.HostCount > 0 || options.SplitPrefix > 0 || options.SplitRatio != "" {
+			return errors.New("vlsm can't be used with sbc, sbh, sbp, sbr or subnet navigation")
+		}
+		if _, err := readSubnetRequests(options.VLSM); err != nil {
+			return err
+		}
+	}
+
+	if options.SkipEnds < 0 {
+		return errors.New("skip-ends must be positive")
+	}
+
+	if options.Info && (options.hasNavigation() || options.VLSM != "" || options.Slices > 0 || options.HostCount > 0 || options.SplitPrefix > 0 || options.SplitRatio != "") {
+		return errors.New("info can't be used with sbc, sbh, sbp, sbr, subnet navigation or vlsm")
+	}
+
+	if options.JSON && !options.Info {
+		return errors.New("json can only be used with info")
+	}
+
+	if options.Notation != "" {
+		if _, err := mapcidr.ParseNotation(options.Notation); err != nil {
+			return err
+		}
+	}
+
+	if options.NextFree < 0 || options.NextFree > 128 {
+		return fmt.Errorf("invalid free prefix length %d", options.NextFree)
+	}
+
+	if options.SplitPrefix < 0 || options.SplitPrefix > 128 {
+		return fmt.Errorf("invalid prefix length %d", options.SplitPrefix)
+	}
+
 	if options.SortAscending && options.SortDescending {
 		return errors.New("can sort only in one direction")
 	}
@@ -237,12 +368,43 @@ func (options *Options) validateOptions() error {
 		return errors.New("both match and filter mode specified")
 	}
 
+	if (options.Seed != 0 || options.Resume != "" || options.Shard != "") && !options.Shuffle {
+		return errors.New("seed, resume and shard can only be used with shuffle")
+	}
+
+	if options.Shard != "" {
+		if _, _, err := parseShard(options.Shard); err != nil {
+			return err
+		}
+		if options.Seed == 0 {
+			return errors.New("shard requires a seed shared by all the workers")
+		}
+	}
+
 	if (options.SortAscending || options.SortDescending) && options.Aggregate {
 		return errors.New("can sort only IPs. sorting can't be used with aggregate")
 	}
 	return nil
 }
 
+// hasNavigation reports whether subnets related to the input CIDRs are
+// asked for instead of the CIDRs themselves.
+func (options *Options) hasNavigation() bool {
+	return options.Parent > 0 || options.Sibling || options.Next > 0 || options.Previous > 0
+}
+
+// skipsHosts reports whether IPs are skipped at the ends of the input
+// subnets, which only applies when their IPs are output.
+func (options *Options) skipsHosts() bool {
+	if !options.SkipBaseIP && !options.SkipBroadcastIP && options.SkipEnds == 0 {
+		return false
+	}
+	return !options.Info && !options.Aggregate && !options.AggregateApprox && !options.Range &&
+		options.Slices == 0 && options.HostCount == 0 && options.SplitPrefix == 0 && options.SplitRatio == "" &&
+		options.Partition == 0 && options.PartitionWeights == "" && options.Free == nil && options.NextFree == 0 &&
+		!options.hasNavigation() && options.VLSM == ""
+}
+
 // configureOutput configures the output on the screen
 func (options *Options) configureOutput() {
 	if options.Silent {
@@ -254,6 +416,33 @@ func (options *Options) configureOutput() {
 
 var options *Options
 
+// matchIPSet and filterIPSet hold the addresses given to -mi and -fi
+var matchIPSet, filterIPSet mapcidr.IPSet
+
+// specialIPSet holds the special-purpose addresses removed from the input
+var specialIPSet mapcidr.IPSet
+
+// specialPurposeExclusions returns the special-purpose addresses removed from
+// the input by the -exclude-* and -only-public flags
+func specialPurposeExclusions() mapcidr.IPSet {
+	var set mapcidr.IPSet
+	if options.ExcludePrivate {
+		set = set.Union(mapcidr.CategorySet(mapcidr.CategoryPrivate, mapcidr.CategoryCGNAT, mapcidr.CategoryULA))
+	}
+	if options.ExcludeReserved {
+		set = set.Union(mapcidr.CategorySet(mapcidr.CategoryReserved, mapcidr.CategoryLoopback, mapcidr.CategoryLinkLocal, mapcidr.CategoryMulticast, mapcidr.CategoryDocumentation, mapcidr.CategoryBenchmarking))
+	}
+	if options.ExcludeBogons {
+		set = set.Union(mapcidr.SpecialPurposeSet(func(block mapcidr.SpecialPurposeBlock) bool {
+			return !block.GloballyReachable
+		}))
+	}
+	if options.OnlyPublic {
+		set = set.Union(mapcidr.CategorySet(mapcidr.CategoryGlobalUnicast).Complement())
+	}
+	return set
+}
+
 func main() {
 	options = ParseOptions()
 	chancidr := make(chan string)
@@ -284,31 +473,16 @@ func main() {
 	wg.Wait()
 }
 
-func filterIPsFromFlagList(channel chan string, ip string, ipFlagList []string) {
-	if len(ipFlagList) == 0 {
-		sendToOutputChannel(ip, channel)
-		return
-	}
-	if options.MatchIP != nil {
-		for _, item := range ipFlagList {
-			if strings.EqualFold(ip, item) {
-				sendToOutputChannel(ip, channel)
-				break
-			}
-		}
-	} else if options.FilterIP != nil {
-		var contains = false
-		for _, item := range ipFlagList {
-			if ip == item {
-				contains = true
-			}
+func filterIPsFromFlagList(channel chan string, ip string) {
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		if options.MatchIP != nil && !matchIPSet.Contains(addr) {
+			return
 		}
-		if !contains {
-			sendToOutputChannel(ip, channel)
+		if options.FilterIP != nil && filterIPSet.Contains(addr) {
+			return
 		}
-	} else {
-		sendToOutputChannel(ip, channel)
 	}
+	sendToOutputChannel(ip, channel)
 }
 func sendToOutputChannel(ip string, channel chan string) {
 	ipnet := net.ParseIP(ip)
@@ -334,44 +508,27 @@ func sendToOutputChannel(ip string, channel chan string) {
 		channel <- ip
 	}
 }
-func prepareIPsFromCidrFlagList(items []string) []string {
-	var flagIPList []string
-	for _, item := range items {
-		if _, pCidr, err := net.ParseCIDR(item); err == nil && pCidr != nil {
-			if ips, err := mapcidr.IPAddressesAsStream(pCidr.String()); err == nil {
-				for ip := range ips {
-					flagIPList = append(flagIPList, ip)
-				}
-			}
-		} else {
-			flagIPList = append(flagIPList, item)
-		}
+
+// ipSetFromFlagList returns the set of the IPs, CIDRs and ranges given to
+// the flag, invalid items being fatal as in the shuffle exclusions. The
+// ip:port items only apply to -fi when shuffling ports, so they are ignored
+// with a warning otherwise.
+func ipSetFromFlagList(flag string, items []string) mapcidr.IPSet {
+	list, err := mapcidr.ParseExclusions(items)
+	if err != nil {
+		gologger.Fatal().Msgf("Could not parse -%s: %s\n", flag, err)
+	}
+	if flag != "fi" || !options.Shuffle {
+		warnIgnoredAddrPorts(list.AddrPorts)
 	}
-	return flagIPList
+	return list.Addrs
 }
-func cidrsToNetworks(cidrs []string) ([]*net.IPNet, error) {
-	networks := make([]*net.IPNet, 0, len(cidrs))
-	for _, cidr := range cidrs {
-		_, network, err := net.ParseCIDR(cidr)
-		if err != nil {
-			// try to parse as ip
-			if ip := net.ParseIP(cidr); ip != nil {
-				if ip.To4() != nil {
-					cidr += "/32"
-				} else {
-					cidr += "/128"
-				}
-				_, network, err = net.ParseCIDR(cidr)
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				return nil, err
-			}
-		}
-		networks = append(networks, network)
+
+// warnIgnoredAddrPorts warns that the ip:port items don't apply
+func warnIgnoredAddrPorts(addrPorts []netip.AddrPort) {
+	for _, addrPort := range addrPorts {
+		gologger.Warning().Msgf("%s is ignored, ip:port filters only apply to shuffled ports\n", addrPort)
 	}
-	return networks, nil
 }
 
 func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
@@ -382,12 +539,53 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 		ranger        *ipranger.IPRanger
 		err           error
 		hasSort       = options.SortAscending || options.SortDescending
-		ipRangeList   = make([][]net.IP, 0)
+		hasPartition  = options.Partition > 0 || options.PartitionWeights != ""
+		hasFree       = options.Free != nil || options.NextFree > 0
+		skipHosts     = options.skipsHosts()
+		collectAll    = options.Aggregate || options.Shuffle || hasSort || options.AggregateApprox || options.Count || hasPartition || hasFree
+		ipRangeList   []mapcidr.IPRange
 		asnNumberList []string
+		portTargets   []mapcidr.Target
 	)
 
+	matchIPSet = ipSetFromFlagList("mi", options.MatchIP)
+	filterIPSet = ipSetFromFlagList("fi", options.FilterIP)
+	specialIPSet = specialPurposeExclusions()
+	excludeIPSet := filterIPSet.Union(specialIPSet)
+
 	ranger, _ = ipranger.New()
+	// the input is split on commas, including inside the port lists of the
+	// targets with their own ports, so their lists are joined back
+	var portTargetInputs []string
+	lastIsPortTarget := false
 	for cidr := range chancidr {
+		if lastIsPortTarget {
+			if _, err := mapcidr.ParsePorts(cidr); err == nil {
+				portTargetInputs[len(portTargetInputs)-1] += "," + cidr
+				continue
+			}
+		}
+		lastIsPortTarget = false
+
+		// targets with their own ports, e.g. 10.0.0.0/24:80,443
+		if target, err := mapcidr.ParseTarget(cidr); err == nil && target.Ports.Len() > 0 {
+			if !options.Shuffle {
+				gologger.Fatal().Msgf("%s: per-target ports can only be used with shuffle\n", cidr)
+			}
+			portTargetInputs = append(portTargetInputs, cidr)
+			lastIsPortTarget = true
+			continue
+		}
+
+		// netmask and wildcard notations, e.g. 192.168.1.0 255.255.255.0
+		if hasMask(cidr) {
+			prefix, err := mapcidr.ParseMaskPrefix(cidr)
+			if err != nil {
+				gologger.Fatal().Msgf("%s\n", err)
+			}
+			cidr = prefix.String()
+		}
+
 		// if it's an ip turn it into a cidr
 		if ip := net.ParseIP(cidr); ip != nil {
 			if options.FilterIP != nil && sliceutil.Contains(options.FilterIP, cidr) {
@@ -401,28 +599,30 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 		}
 
 		cidrsToProcess := []string{cidr}
-		if len(options.FilterIP) > 0 && strings.Contains(cidr, "/") {
-			inputNetworks, err := cidrsToNetworks([]string{cidr})
-			if err != nil {
-				gologger.Fatal().Msgf("%s\n", err)
-			}
-			filterNetworks, err := cidrsToNetworks(options.FilterIP)
-			if err != nil {
-				gologger.Fatal().Msgf("%s\n", err)
-			}
-			newNetworks, err := mapcidr.RemoveCIDRs(inputNetworks, filterNetworks)
+		// -info describes the input subnets themselves, not what's left of them
+		if (!excludeIPSet.IsEmpty() || skipHosts) && !options.Info && strings.Contains(cidr, "/") {
+			_, network, err := net.ParseCIDR(cidr)
 			if err != nil {
 				gologger.Fatal().Msgf("%s\n", err)
 			}
-			cidrsToProcess = make([]string, 0, len(newNetworks))
-			for _, newNet := range newNetworks {
-				cidrsToProcess = append(cidrsToProcess, newNet.String())
+			// the ends of the subnet are skipped before the exclusions split it
+			remaining := hostIPSet([]*net.IPNet{network}).Difference(excludeIPSet)
+			cidrsToProcess = make([]string, 0)
+			for _, prefix := range remaining.Prefixes() {
+				cidrsToProcess = append(cidrsToProcess, prefix.String())
 			}
 		}
 
 		for _, cidr := range cidrsToProcess {
 
 			if strings.Contains(cidr, "-") {
+				// Add IPs into ipRangeList which are passed as input. Example - "192.168.0.0-192.168.0.5" or "192.168.0.1 - 3"
+				ipRange, err := mapcidr.ParseRange(cidr)
+				if err == nil {
+					ipRangeList = append(ipRangeList, ipRange)
+					continue
+				}
+
 				// Try to parse as multi-octet range
 				if strings.Count(cidr, ".") == 3 {
 					ips, err := mapcidr.ExpandIPPattern(cidr)
@@ -431,8 +631,11 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 					}
 
 					for _, ip := range ips {
+						if addr, ok := mapcidr.AddrFromIP(ip); ok && specialIPSet.Contains(addr) {
+							continue
+						}
 						ipCidr := ip.String() + "/32"
-						if options.Aggregate || options.Shuffle || hasSort || options.AggregateApprox || options.Count {
+						if collectAll {
 							_, ipnet, _ := net.ParseCIDR(ipCidr)
 							allCidrs = append(allCidrs, ipnet)
 						} else {
@@ -442,16 +645,7 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 					continue
 				}
 
-				// Add IPs into ipRangeList which are passed as input. Example - "192.168.0.0-192.168.0.5"
-				var ipRange []net.IP
-				for _, ipstr := range strings.Split(cidr, "-") {
-					ipRange = append(ipRange, net.ParseIP(ipstr))
-				}
-				if len(ipRange) > 2 {
-					gologger.Fatal().Msgf("IP range can not have more than 2 values.")
-				}
-				ipRangeList = append(ipRangeList, ipRange)
-				continue
+				gologger.Fatal().Msgf("%s\n", err)
 			}
 
 			// Add ASN number
@@ -475,7 +669,7 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 			}
 
 			// In case of coalesce/shuffle we need to know all the cidrs and aggregate them by calling the proper function
-			if options.Aggregate || options.Shuffle || hasSort || options.AggregateApprox || options.Count {
+			if collectAll {
 				_ = ranger.Add(cidr)
 				allCidrs = append(allCidrs, pCidr)
 			} else {
@@ -484,12 +678,36 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 		}
 	}
 
-	for _, ipRange := range ipRangeList {
-		cidrs, err := mapcidr.GetCIDRFromIPRange(ipRange[0], ipRange[1])
+	for _, input := range portTargetInputs {
+		target, err := mapcidr.ParseTarget(input)
 		if err != nil {
 			gologger.Fatal().Msgf("%s\n", err)
 		}
-		if options.Aggregate || options.Shuffle || hasSort || options.AggregateApprox || options.Count {
+		isCidr4 := target.Prefix.Addr().Is4()
+		if (options.FilterIP4 && !isCidr4) || (options.FilterIP6 && isCidr4) {
+			continue
+		}
+		if skipHosts {
+			for _, prefix := range hostIPSet(mapcidr.IPNetsFromPrefixes([]netip.Prefix{target.Prefix})).Prefixes() {
+				portTargets = append(portTargets, mapcidr.Target{Prefix: prefix, Ports: target.Ports})
+			}
+			continue
+		}
+		portTargets = append(portTargets, target)
+	}
+
+	for _, ipRange := range ipRangeList {
+		if skipHosts {
+			// only the ends of the range itself are skipped, not the ends of
+			// the subnets it's made of
+			var ok bool
+			if ipRange, ok = hostRange(ipRange); !ok {
+				continue
+			}
+		}
+		remaining := mapcidr.IPSetFromRanges([]mapcidr.IPRange{ipRange}).Difference(specialIPSet)
+		cidrs := mapcidr.IPNetsFromPrefixes(remaining.Prefixes())
+		if collectAll {
 			allCidrs = append(allCidrs, cidrs...)
 		} else {
 			for _, cidr := range cidrs {
@@ -503,7 +721,10 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 		if err != nil {
 			gologger.Fatal().Msgf("%s\n", err)
 		}
-		if options.Aggregate || options.Shuffle || hasSort || options.AggregateApprox || options.Count {
+		if (!specialIPSet.IsEmpty() || skipHosts) && !options.Info {
+			cidrs = mapcidr.IPNetsFromPrefixes(hostIPSet(cidrs).Difference(specialIPSet).Prefixes())
+		}
+		if collectAll {
 			allCidrs = append(allCidrs, cidrs...)
 		} else {
 			for _, cidr := range cidrs {
@@ -514,26 +735,14 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 
 	// Shuffle perform the aggregation
 	if options.Shuffle {
-		var ports []int
+		var ports mapcidr.PortSet
 		if options.ShufflePorts != "" {
-			for _, p := range strings.Split(options.ShufflePorts, ",") {
-				port, err := strconv.Atoi(p)
-				if err != nil {
-					gologger.Fatal().Msgf("%s\n", err)
-				}
-				ports = append(ports, port)
-			}
-		}
-		cCidrsIPV4, _ := mapcidr.CoalesceCIDRs(allCidrs)
-		if len(ports) > 0 {
-			for ip := range mapcidr.ShuffleCidrsWithPortsAndSeed(cCidrsIPV4, ports, time.Now().Unix()) {
-				outputchan <- ip.String()
-			}
-		} else {
-			for ip := range mapcidr.ShuffleCidrsWithSeed(cCidrsIPV4, time.Now().Unix()) {
-				outputchan <- ip.IP
+			var err error
+			if ports, err = mapcidr.ParsePorts(options.ShufflePorts); err != nil {
+				gologger.Fatal().Msgf("%s\n", err)
 			}
 		}
+		shuffleTargets(allCidrs, ports, portTargets, outputchan)
 	}
 
 	// Aggregate all ips into the minimal subset possible
@@ -573,20 +782,333 @@ func process(wg *sync.WaitGroup, chancidr, outputchan chan string) {
 		}
 	}
 
+	if hasPartition {
+		partitionTargets(allCidrs, outputchan)
+	}
+
+	if hasFree {
+		freeSpace(allCidrs, outputchan)
+	}
+
 	if options.Count {
-		includeBase := !options.SkipBaseIP
-		includeBroadcast := !options.SkipBroadcastIP
-		ipSum := mapcidr.CountIPsInCIDRs(includeBase, includeBroadcast, allCidrs...)
+		// the skipped IPs are already out of the cidrs
+		ipSum := mapcidr.CountIPsInCIDRs(true, true, allCidrs...)
 		outputchan <- ipSum.String()
 	}
 	close(outputchan)
 }
 
+// shuffleTargets outputs the cidrs combined with the ports, and the targets
+// with their own ports, in random order, resuming from and saving the
+// progress to the resume file if any
+func shuffleTargets(cidrs []*net.IPNet, ports mapcidr.PortSet, portTargets []mapcidr.Target, outputchan chan string) {
+	prefixes, err := mapcidr.PrefixesFromIPNets(cidrs)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	targets := make([]mapcidr.Target, 0, len(prefixes)+len(portTargets))
+	for _, prefix := range prefixes {
+		targets = append(targets, mapcidr.Target{Prefix: prefix, Ports: ports})
+	}
+	targets = append(targets, portTargets...)
+
+	// the filtered targets are skipped during the walk, whatever the way the input was given
+	exclude, err := mapcidr.ParseExclusions(options.FilterIP)
+	if err != nil {
+		gologger.Fatal().Msgf("Could not parse -fi: %s\n", err)
+	}
+	if ports.Len() == 0 && len(portTargets) == 0 {
+		warnIgnoredAddrPorts(exclude.AddrPorts)
+	}
+	exclude.Addrs = exclude.Addrs.Union(specialIPSet)
+	shuffleOptions := mapcidr.ShuffleOptions{Seed: options.Seed, Exclude: exclude}
+	if shuffleOptions.Seed == 0 {
+		shuffleOptions.Seed = time.Now().UnixNano()
+	}
+	if options.Shard != "" {
+		if shuffleOptions.Shard, shuffleOptions.Shards, err = parseShard(options.Shard); err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+	}
+	var checkpoint *mapcidr.Checkpoint
+	if options.Resume != "" {
+		if checkpoint, err = readCheckpoint(options.Resume); err != nil {
+			gologger.Fatal().Msgf("Could not read resume file '%s': %s\n", options.Resume, err)
+		}
+	}
+	if checkpoint != nil {
+		if options.Seed != 0 && options.Seed != checkpoint.Seed {
+			gologger.Fatal().Msgf("seed %d differs from the seed %d of the resume file\n", options.Seed, checkpoint.Seed)
+		}
+		if checkpoint.Shard != shuffleOptions.Shard || checkpoint.Shards != shuffleOptions.Shards {
+			gologger.Fatal().Msgf("shard differs from the shard of the resume file\n")
+		}
+		shuffleOptions.Seed = checkpoint.Seed
+		shuffleOptions.StartIndex = checkpoint.Index
+	}
+
+	shuffler, err := mapcidr.NewTargetShuffler(targets, shuffleOptions)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	if checkpoint != nil && (checkpoint.Total == nil || checkpoint.Total.Cmp(shuffler.Total()) != 0) {
+		gologger.Fatal().Msgf("resume file '%s' was created for other targets\n", options.Resume)
+	}
+	gologger.Info().Msgf("Shuffling %s targets with seed %d\n", shuffler.Total(), shuffleOptions.Seed)
+
+	if options.Resume == "" {
+		for target := range shuffler.All() {
+			outputchan <- targetString(target)
+		}
+		return
+	}
+
+	// the output takes a target once it has written the previous one, so
+	// only the progress of the targets taken before the last one is saved,
+	// and it is saved on an interruption before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	saveCheckpoint := func(checkpoint mapcidr.Checkpoint) {
+		if err := writeCheckpoint(options.Resume, checkpoint); err != nil {
+			gologger.Error().Msgf("Could not write resume file '%s': %s\n", options.Resume, err)
+		}
+	}
+	send := func(item string, written mapcidr.Checkpoint) {
+		select {
+		case outputchan <- item:
+		case <-ctx.Done():
+			saveCheckpoint(written)
+			gologger.Info().Msgf("Interrupted, progress saved to '%s'\n", options.Resume)
+			os.Exit(1)
+		}
+	}
+	written, sent := shuffler.Checkpoint(), shuffler.Checkpoint()
+	lastCheckpoint := time.Now()
+	for target := range shuffler.All() {
+		send(targetString(target), written)
+		written, sent = sent, shuffler.Checkpoint()
+		if time.Since(lastCheckpoint) >= options.CheckpointInterval {
+			saveCheckpoint(written)
+			lastCheckpoint = time.Now()
+		}
+	}
+	// the output skips the empty item, which it takes once the last target
+	// is written
+	send("", written)
+	saveCheckpoint(shuffler.Checkpoint())
+}
+
+// targetString returns the shuffled target, with its port if it has one
+func targetString(target netip.AddrPort) string {
+	if target.Port() != 0 {
+		return target.String()
+	}
+	return target.Addr().String()
+}
+
+// partitionTargets splits all the input IPs into groups with the same number
+// of IPs, or proportional to the weights, outputting the CIDRs of each group
+// prefixed with the group number and writing them to a file per group if an
+// output file is set
+func partitionTargets(cidrs []*net.IPNet, outputchan chan string) {
+	weights := make([]int, options.Partition)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if options.PartitionWeights != "" {
+		var err error
+		if weights, err = parseWeights(options.PartitionWeights); err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+	}
+	groups, err := mapcidr.IPSetFromIPNets(cidrs).PartitionWeighted(weights)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	notation := outputNotation()
+	for i, group := range groups {
+		var f *os.File
+		if options.Output != "" {
+			file := partitionFileName(options.Output, i+1)
+			if f, err = os.Create(file); err != nil {
+				gologger.Fatal().Msgf("Could not create output file '%s': %s\n", file, err)
+			}
+		}
+		for _, prefix := range group.Prefixes() {
+			item := mapcidr.FormatPrefix(prefix, notation)
+			outputchan <- fmt.Sprintf("%d %s", i+1, item)
+			if f != nil {
+				_, _ = f.WriteString(item + "\n")
+			}
+		}
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+}
+
+// freeSpace outputs the gaps left in the cidrs by the -free list, as CIDRs
+// or as ranges with -r, or only the first free subnet with -next-free
+func freeSpace(cidrs []*net.IPNet, outputchan chan string) {
+	pools, err := mapcidr.PrefixesFromIPNets(cidrs)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	free := mapcidr.IPSetFromPrefixes(pools).Difference(ipSetFromFlagList("free", options.Free))
+	if options.NextFree > 0 {
+		prefix, ok := free.FirstPrefix(options.NextFree)
+		if !ok {
+			gologger.Fatal().Msgf("no free /%d left\n", options.NextFree)
+		}
+		outputchan <- prefix.String()
+		return
+	}
+	if options.Range {
+		for _, r := range free.Ranges() {
+			outputchan <- r.String()
+		}
+		return
+	}
+	for _, prefix := range free.Prefixes() {
+		outputchan <- prefix.String()
+	}
+}
+
+// partitionFileName returns the output file of a partition group, numbering
+// the output file name, e.g. targets-2.txt for targets.txt
+func partitionFileName(output string, group int) string {
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(output, ext), group, ext)
+}
+
+// parseWeights parses a list of weights separated by commas or colons
+func parseWeights(value string) ([]int, error) {
+	var weights []int
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ':' }) {
+		weight, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q", item)
+		}
+		weights = append(weights, weight)
+	}
+	return weights, nil
+}
+
+// readSubnetRequests reads the subnets to allocate from a file with one
+// "name hosts" per line, the name and hosts being separated by spaces, a
+// comma or a colon. Empty lines and lines starting with # are skipped.
+func readSubnetRequests(file string) ([]mapcidr.SubnetRequest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var requests []mapcidr.SubnetRequest
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ':' || r == ' ' || r == '\t' })
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: invalid subnet %q, expected a name and a number of hosts", file, i+1, line)
+		}
+		hosts, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || hosts == 0 {
+			return nil, fmt.Errorf("%s:%d: invalid number of hosts %q", file, i+1, fields[1])
+		}
+		requests = append(requests, mapcidr.SubnetRequest{Name: fields[0], Hosts: hosts})
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%s: no subnet to allocate", file)
+	}
+	return requests, nil
+}
+
+// parseShard parses a 1-based "i/n" shard into the 0-based shard index and the shard count
+func parseShard(value string) (shard, shards int, err error) {
+	index, count, ok := strings.Cut(value, "/")
+	if ok {
+		shard, err = strconv.Atoi(index)
+		if err == nil {
+			shards, err = strconv.Atoi(count)
+		}
+	}
+	if !ok || err != nil || shard < 1 || shards < 1 || shard > shards {
+		return 0, 0, fmt.Errorf("invalid shard %q, expected i/n with 1 <= i <= n", value)
+	}
+	return shard - 1, shards, nil
+}
+
+// readCheckpoint reads a checkpoint from a file, returning nil if the file doesn't exist
+func readCheckpoint(file string) (*mapcidr.Checkpoint, error) {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint mapcidr.Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// writeCheckpoint replaces the file with the checkpoint through a rename, so
+// that an interruption never leaves a partially written file
+func writeCheckpoint(file string, checkpoint mapcidr.Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
 /*
 The purpose of the function is split into subnets or split by no. of host or CIDR expansion.
 This gives us benefit of DRY and we can add new features here going forward.
 */
 func commonFunc(cidr string, outputchan chan string) {
+	if options.Info {
+		subnetInfo(cidr, outputchan)
+		return
+	}
+	if options.hasNavigation() {
+		navigate(cidr, outputchan)
+		return
+	}
+	if options.VLSM != "" {
+		allocateSubnets(cidr, outputchan)
+		return
+	}
+	if options.Slices > 0 && options.Balanced {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		chunks, err := mapcidr.SplitPrefixBalanced(prefix, options.Slices)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		// each chunk is the workload of one worker
+		for _, chunk := range chunks {
+			if options.Range {
+				outputchan <- chunk.String()
+				continue
+			}
+			var subnets []string
+			for _, subnet := range chunk.Prefixes() {
+				subnets = append(subnets, subnet.String())
+			}
+			outputchan <- strings.Join(subnets, ",")
+		}
+		return
+	}
 	if options.Range {
 		_, network, err := net.ParseCIDR(cidr)
 		if err != nil {
@@ -608,25 +1130,190 @@ func commonFunc(cidr string, outputchan chan string) {
 			outputchan <- subnet.String()
 		}
 	} else if options.HostCount > 0 {
-		subnets, err := mapcidr.SplitByNumber(cidr, options.HostCount)
+		prefix, err := netip.ParsePrefix(cidr)
 		if err != nil {
 			gologger.Fatal().Msgf("%s\n", err)
 		}
-		for _, subnet := range subnets {
+		// large IPv6 networks can yield more subnets than fit in memory
+		subnets, err := mapcidr.SplitPrefixByNumberSeq(prefix, options.HostCount)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		for subnet := range subnets {
+			outputchan <- subnet.String()
+		}
+	} else if options.SplitRatio != "" {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		weights, err := parseWeights(options.SplitRatio)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		parts, err := mapcidr.SplitPrefixByRatio(prefix, weights, options.SplitPrefix)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		for _, part := range parts {
+			var subnets []string
+			for _, subnet := range part {
+				subnets = append(subnets, subnet.String())
+			}
+			outputchan <- strings.Join(subnets, ",")
+		}
+	} else if options.SplitPrefix > 0 {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		// subnets already as small as asked are left as they are
+		if prefix.Bits() >= options.SplitPrefix {
+			outputchan <- prefix.Masked().String()
+			return
+		}
+		count, err := mapcidr.SplitPrefixByLengthCount(prefix, options.SplitPrefix)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		if options.SplitLimit > 0 && count.Cmp(big.NewInt(int64(options.SplitLimit))) > 0 {
+			gologger.Fatal().Msgf("slicing %s into /%d yields %s subnets, more than the split limit of %d\n", prefix, options.SplitPrefix, count, options.SplitLimit)
+		}
+		subnets, err := mapcidr.SplitPrefixByLengthSeq(prefix, options.SplitPrefix)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		for subnet := range subnets {
 			outputchan <- subnet.String()
 		}
 	} else {
-		var ipFlagList []string
-		ipFlagList = append(ipFlagList, prepareIPsFromCidrFlagList(options.MatchIP)...)
-		ipFlagList = append(ipFlagList, prepareIPsFromCidrFlagList(options.FilterIP)...)
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		for ip := range mapcidr.IPAddressesSeq(ipnet) {
+			filterIPsFromFlagList(outputchan, ip)
+		}
+	}
+}
 
-		ips, err := mapcidr.IPAddressesAsStream(cidr)
+// subnetInfo outputs the information about the cidr, one labelled value
+// per line or as a JSON line with -json
+func subnetInfo(cidr string, outputchan chan string) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	info, err := mapcidr.NewSubnetInfo(prefix)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	if options.JSON {
+		data, err := json.Marshal(info)
 		if err != nil {
 			gologger.Fatal().Msgf("%s\n", err)
 		}
-		for ip := range ips {
-			filterIPsFromFlagList(outputchan, ip, ipFlagList)
+		outputchan <- string(data)
+		return
+	}
+
+	lines := [][2]string{
+		{"Address", info.Address.String()},
+		{"Network", info.Prefix.String()},
+		{"Netmask", fmt.Sprintf("%s = %d", info.Netmask, info.Prefix.Bits())},
+		{"Wildcard", info.Wildcard.String()},
+	}
+	if info.Broadcast.IsValid() {
+		lines = append(lines, [2]string{"Broadcast", info.Broadcast.String()})
+	}
+	lines = append(lines,
+		[2]string{"HostMin", info.FirstHost.String()},
+		[2]string{"HostMax", info.LastHost.String()},
+		[2]string{"Hosts", info.Hosts.String()},
+		[2]string{"Addresses", info.Addresses.String()},
+		[2]string{"Binary", info.Binary},
+		[2]string{"Class", info.Class},
+		[2]string{"Address space", info.AddressSpace},
+	)
+	if info.Version == 6 {
+		nibble := "no"
+		if info.NibbleAligned {
+			nibble = "yes"
+		}
+		lines = append(lines,
+			[2]string{"Compressed", info.Network.String()},
+			[2]string{"Expanded", info.Expanded},
+			[2]string{"Nibble boundary", nibble},
+		)
+	}
+	lines = append(lines, [2]string{"Reverse zone", info.ReverseZone})
+
+	var sb strings.Builder
+	for _, line := range lines {
+		if line[1] != "" {
+			fmt.Fprintf(&sb, "%-17s%s\n", line[0]+":", line[1])
+		}
+	}
+	// a blank line separates the CIDRs
+	outputchan <- sb.String()
+}
+
+// navigate outputs the parent, sibling, previous and next subnets of the
+// cidr, as asked by the options. Walking past either end of the address
+// space stops with a warning.
+func navigate(cidr string, outputchan chan string) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	if options.Parent > 0 {
+		parent, err := mapcidr.ParentPrefix(prefix, options.Parent)
+		if err != nil {
+			gologger.Fatal().Msgf("%s\n", err)
+		}
+		outputchan <- parent.String()
+	}
+	if options.Sibling {
+		sibling, err := mapcidr.SiblingPrefix(prefix)
+		if err != nil {
+			gologger.Warning().Msgf("%s\n", err)
+		} else {
+			outputchan <- sibling.String()
+		}
+	}
+	for i, current := 0, prefix; i < options.Previous; i++ {
+		if current, err = mapcidr.PreviousPrefix(current); err != nil {
+			gologger.Warning().Msgf("%s\n", err)
+			break
+		}
+		outputchan <- current.String()
+	}
+	for i, current := 0, prefix; i < options.Next; i++ {
+		if current, err = mapcidr.NextPrefix(current); err != nil {
+			gologger.Warning().Msgf("%s\n", err)
+			break
 		}
+		outputchan <- current.String()
+	}
+}
+
+// allocateSubnets outputs the subnets of the -vlsm file allocated in the
+// cidr, one "name cidr usable-range spare-hosts" per line.
+func allocateSubnets(cidr string, outputchan chan string) {
+	pool, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	requests, err := readSubnetRequests(options.VLSM)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	allocations, err := mapcidr.AllocateSubnets(pool, requests)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	for _, allocation := range allocations {
+		outputchan <- fmt.Sprintf("%s %s %s %s", allocation.Name, allocation.Prefix, allocation.Usable, allocation.Spare())
 	}
 }
 
@@ -634,7 +1321,8 @@ func output(wg *sync.WaitGroup, outputchan chan string) {
 	defer wg.Done()
 
 	var f *os.File
-	if options.Output != "" {
+	// partition groups are written to their own files
+	if options.Output != "" && options.Partition == 0 && options.PartitionWeights == "" {
 		var err error
 		f, err = os.Create(options.Output)
 		if err != nil {
@@ -642,17 +1330,12 @@ func output(wg *sync.WaitGroup, outputchan chan string) {
 		}
 		defer f.Close() //nolint
 	}
+	notation := outputNotation()
 	for o := range outputchan {
 		if o == "" {
 			continue
 		}
-		if options.SkipBaseIP && mapcidr.IsBaseIP(o) {
-			continue
-		}
-		if options.SkipBroadcastIP && mapcidr.IsBroadcastIP(o) {
-			continue
-		}
-
+		o = formatNotation(o, notation)
 		if len(options.IPFormats) > 0 {
 			outputItems(f, mapcidr.AlterIP(o, options.IPFormats, options.ZeroPadNumberOfZeroes, options.ZeroPadPermute)...)
 		} else {
@@ -661,6 +1344,28 @@ func output(wg *sync.WaitGroup, outputchan chan string) {
 	}
 }
 
+// outputNotation returns the -notation of the output CIDRs, validated with
+// the options
+func outputNotation() mapcidr.Notation {
+	if options.Notation == "" {
+		return mapcidr.NotationCIDR
+	}
+	notation, _ := mapcidr.ParseNotation(options.Notation)
+	return notation
+}
+
+// formatNotation writes the output item in the notation if it's a CIDR
+func formatNotation(item string, notation mapcidr.Notation) string {
+	if notation == mapcidr.NotationCIDR {
+		return item
+	}
+	prefix, err := netip.ParsePrefix(item)
+	if err != nil {
+		return item
+	}
+	return mapcidr.FormatPrefix(prefix, notation)
+}
+
 func outputItems(f *os.File, items ...string) {
 	for _, item := range items {
 		gologger.Silent().Msgf("%s\n", item)
@@ -670,15 +1375,67 @@ func outputItems(f *os.File, items ...string) {
 	}
 }
 
+// hasMask reports whether the input is a CIDR written with a netmask or a
+// wildcard mask, e.g. 192.168.1.0 255.255.255.0 or 10.0.0.0/0.0.255.255
+func hasMask(input string) bool {
+	if strings.Contains(input, "-") {
+		return false
+	}
+	if len(strings.Fields(input)) == 2 {
+		return true
+	}
+	_, mask, found := strings.Cut(input, "/")
+	return found && strings.Contains(mask, ".")
+}
+
+// hostIPSet returns the IPs of the networks, without the network and
+// broadcast IPs or the IPs at the ends of each of them, as asked by the
+// skip options. Following RFC 3021, /31 and /32 networks are kept whole.
+func hostIPSet(networks []*net.IPNet) mapcidr.IPSet {
+	prefixes, err := mapcidr.PrefixesFromIPNets(networks)
+	if err != nil {
+		gologger.Fatal().Msgf("%s\n", err)
+	}
+	ranges := make([]mapcidr.IPRange, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		hosts := mapcidr.PrefixHostRange(prefix, options.SkipBaseIP, options.SkipBroadcastIP)
+		if options.SkipEnds > 0 && prefix.Addr().BitLen()-prefix.Bits() > 1 {
+			var ok bool
+			if hosts, ok = mapcidr.PrefixRange(prefix).Trim(uint64(options.SkipEnds), uint64(options.SkipEnds)); !ok {
+				continue
+			}
+		}
+		ranges = append(ranges, hosts)
+	}
+	return mapcidr.IPSetFromRanges(ranges)
+}
+
+// hostRange returns the range without the IPs at its ends asked by the skip
+// options, its first IP being skipped as a network IP and its last one as a
+// broadcast IP. As /31 and /32 networks, ranges of at most two IPs are kept
+// whole. The second result is false if no IP is left.
+func hostRange(r mapcidr.IPRange) (mapcidr.IPRange, bool) {
+	if r.Size().Cmp(big.NewInt(2)) <= 0 {
+		return r, true
+	}
+	var head, tail uint64
+	if options.SkipBaseIP {
+		head = 1
+	}
+	if options.SkipBroadcastIP {
+		tail = 1
+	}
+	if options.SkipEnds > 0 {
+		head, tail = uint64(options.SkipEnds), uint64(options.SkipEnds)
+	}
+	return r.Trim(head, tail)
+}
+
 // returns the list of expanded IPs of given CIDR list
 func getIPList(cidrs []*net.IPNet) []net.IP {
 	var ipList []net.IP
 	for _, cidr := range cidrs {
-		ips, err := mapcidr.IPAddressesAsStream(cidr.String())
-		if err != nil {
-			gologger.Fatal().Msgf("%s\n", err)
-		}
-		for ip := range ips {
+		for ip := range mapcidr.IPAddressesSeq(cidr) {
 			ipList = append(ipList, net.ParseIP(ip))
 		}
 	}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/projectdiscovery/mapcidr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,6 +61,95 @@ func TestProcess(t *testing.T) {
 			},
 			expectedOutput: []string{"10.40.0.0/25", "10.40.0.128/25"},
 		},
+		{
+			name:       "CIDRSliceByCountBalanced",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr: []string{"10.40.0.0/29"},
+				Slices:   3,
+				Balanced: true,
+			},
+			expectedOutput: []string{"10.40.0.0/31,10.40.0.2/32", "10.40.0.3/32,10.40.0.4/31", "10.40.0.6/31"},
+		},
+		{
+			name:       "CIDRSliceByCountBalancedRange",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr: []string{"10.40.0.0/24"},
+				Slices:   5,
+				Balanced: true,
+				Range:    true,
+			},
+			expectedOutput: []string{"10.40.0.0-10.40.0.51", "10.40.0.52-10.40.0.102", "10.40.0.103-10.40.0.153", "10.40.0.154-10.40.0.204", "10.40.0.205-10.40.0.255"},
+		},
+		{
+			name:       "CIDRSliceByRatio",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr:   []string{"10.40.0.0/16"},
+				SplitRatio: "3:1",
+			},
+			expectedOutput: []string{"10.40.0.0/17,10.40.128.0/18", "10.40.192.0/18"},
+		},
+		{
+			name:       "CIDRSliceByRatioWithPrefixLength",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr:    []string{"10.40.0.0/24"},
+				SplitRatio:  "1,1,1",
+				SplitPrefix: 26,
+			},
+			expectedOutput: []string{"10.40.0.0/25", "10.40.0.128/26", "10.40.0.192/26"},
+		},
+		{
+			name:       "SubnetNavigation",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr: []string{"10.0.1.0/24"},
+				Parent:   16,
+				Sibling:  true,
+				Next:     2,
+				Previous: 1,
+			},
+			expectedOutput: []string{"10.0.0.0/16", "10.0.0.0/24", "10.0.0.0/24", "10.0.2.0/24", "10.0.3.0/24"},
+		},
+		{
+			name:       "SubnetNavigationIPv6",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr: []string{"2001:db8::/48"},
+				Parent:   32,
+				Next:     1,
+			},
+			expectedOutput: []string{"2001:db8::/32", "2001:db8:1::/48"},
+		},
+		{
+			name:       "CIDRSliceByPrefixLength",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr:    []string{"10.40.0.0/23", "10.41.0.0/25", "2c0f:fec9::/47"},
+				SplitPrefix: 24,
+			},
+			expectedOutput: []string{"10.40.0.0/24", "10.40.1.0/24", "10.41.0.0/25", "2c0f:fec9::/47"},
+		},
+		{
+			name:       "CIDRSliceByPrefixLengthIPv6",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr:    []string{"2c0f:fec9::/47"},
+				SplitPrefix: 48,
+				SplitLimit:  2,
+			},
+			expectedOutput: []string{"2c0f:fec9::/48", "2c0f:fec9:1::/48"},
+		},
 		{
 			name:       "CIDRSliceByHostIPv4",
 			chancidr:   make(chan string),
@@ -230,6 +325,14 @@ func TestProcess(t *testing.T) {
 				Aggregate: true,
 			},
 			expectedOutput: []string{"10.0.0.0/32", "10.0.0.2/31"},
+		}, {
+			name:       "SpacedLastOctetRangeExpansion",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr: []string{"192.168.0.1 - 3", "192.168.1.1 - 192.168.1.2"},
+			},
+			expectedOutput: []string{"192.168.0.1", "192.168.0.2", "192.168.0.3", "192.168.1.1", "192.168.1.2"},
 		}, {
 			name:       "MultiOctetRangeExpansion",
 			chancidr:   make(chan string),
@@ -255,6 +358,18 @@ func TestProcess(t *testing.T) {
 				"192.168.1.2",
 			},
 		},
+		{
+			name:       "MatchIPWithCIDR",
+			chancidr:   make(chan string),
+			outputchan: make(chan string),
+			options: Options{
+				FileCidr: []string{"192.168.0.0/29", "2001:db8::/126"},
+				MatchIP:  []string{"192.168.0.2/31", "192.168.0.7", "2001:db8::3"},
+			},
+			expectedOutput: []string{
+				"192.168.0.2", "192.168.0.3", "192.168.0.7", "2001:db8::3",
+			},
+		},
 		{
 			name:       "MultiOctetRangeAggregate",
 			chancidr:   make(chan string),
@@ -324,3 +439,417 @@ func TestProcess(t *testing.T) {
 
 	}
 }
+
+// processOutput runs process over the FileCidr items of opts and returns the output
+func processOutput(opts Options) []string {
+	options = &opts
+	chancidr, outputchan := make(chan string), make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go process(&wg, chancidr, outputchan)
+
+	var outputlist []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for output := range outputchan {
+			// as output does
+			if output != "" {
+				outputlist = append(outputlist, output)
+			}
+		}
+	}()
+	for _, item := range opts.FileCidr {
+		chancidr <- item
+	}
+	close(chancidr)
+	wg.Wait()
+	<-done
+	return outputlist
+}
+
+func TestShuffleResume(t *testing.T) {
+	full := processOutput(Options{FileCidr: []string{"192.168.0.0/28", "2001:db8::/124"}, Shuffle: true, Seed: 42})
+	require.Len(t, full, 32)
+	require.Equal(t, full, processOutput(Options{FileCidr: []string{"192.168.0.0/28", "2001:db8::/124"}, Shuffle: true, Seed: 42}))
+
+	// resume from a checkpoint taken after 10 targets
+	resumeFile := filepath.Join(t.TempDir(), "resume.json")
+	require.NoError(t, writeCheckpoint(resumeFile, mapcidr.Checkpoint{Seed: 42, Index: big.NewInt(10), Total: big.NewInt(32)}))
+	resumed := processOutput(Options{FileCidr: []string{"192.168.0.0/28", "2001:db8::/124"}, Shuffle: true, Resume: resumeFile})
+	require.Equal(t, full[10:], resumed)
+
+	// the resume file records the end of the run
+	checkpoint, err := readCheckpoint(resumeFile)
+	require.NoError(t, err)
+	require.Equal(t, int64(32), checkpoint.Index.Int64())
+	require.Empty(t, processOutput(Options{FileCidr: []string{"192.168.0.0/28", "2001:db8::/124"}, Shuffle: true, Resume: resumeFile}))
+
+	// the progress saved doesn't pass the last target the output has taken,
+	// which it may not have written yet
+	require.NoError(t, os.Remove(resumeFile))
+	options = &Options{Shuffle: true, Seed: 42, Resume: resumeFile}
+	chancidr, outputchan := make(chan string), make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go process(&wg, chancidr, outputchan)
+	for _, item := range []string{"192.168.0.0/28", "2001:db8::/124"} {
+		chancidr <- item
+	}
+	close(chancidr)
+	for range 10 {
+		<-outputchan
+	}
+	require.Eventually(t, func() bool {
+		checkpoint, err = readCheckpoint(resumeFile)
+		return err == nil && checkpoint != nil && checkpoint.Index.Int64() == 9
+	}, time.Second, time.Millisecond)
+	for range outputchan {
+	}
+	wg.Wait()
+	require.NoError(t, writeCheckpoint(resumeFile, *checkpoint))
+	require.Equal(t, full[9:], processOutput(Options{FileCidr: []string{"192.168.0.0/28", "2001:db8::/124"}, Shuffle: true, Resume: resumeFile}))
+}
+
+func TestShuffleShards(t *testing.T) {
+	input := []string{"192.168.0.0/28", "2001:db8::/124"}
+	full := processOutput(Options{FileCidr: input, Shuffle: true, Seed: 42})
+	var union []string
+	for _, shard := range []string{"1/3", "2/3", "3/3"} {
+		union = append(union, processOutput(Options{FileCidr: input, Shuffle: true, Seed: 42, Shard: shard})...)
+	}
+	require.ElementsMatch(t, full, union)
+
+	_, _, err := parseShard("0/3")
+	require.Error(t, err)
+	_, _, err = parseShard("4/3")
+	require.Error(t, err)
+	shard, shards, err := parseShard("2/3")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3}, []int{shard, shards})
+}
+
+func TestShuffleWithFilter(t *testing.T) {
+	// ranges in the input and ip:port pairs in the filter are honored too
+	got := processOutput(Options{
+		FileCidr:     []string{"192.168.0.0-192.168.0.7"},
+		Shuffle:      true,
+		ShufflePorts: "80,443",
+		FilterIP:     []string{"192.168.0.1", "192.168.0.4/31", "192.168.0.2-192.168.0.3", "192.168.0.7:443"},
+	})
+	require.ElementsMatch(t, []string{
+		"192.168.0.0:80", "192.168.0.0:443",
+		"192.168.0.6:80", "192.168.0.6:443",
+		"192.168.0.7:80",
+	}, got)
+}
+
+func TestShuffleWithMaskFilter(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr: []string{"10.0.0.0/29"},
+		Shuffle:  true,
+		FilterIP: []string{"10.0.0.0/255.255.255.252", "10.0.0.6 0.0.0.1"},
+	})
+	require.ElementsMatch(t, []string{"10.0.0.4", "10.0.0.5"}, got)
+
+	got = processOutput(Options{
+		FileCidr:     []string{"10.0.0.0/30"},
+		Shuffle:      true,
+		ShufflePorts: "80",
+		FilterIP:     []string{"10.0.0.0/255.255.255.254"},
+	})
+	require.ElementsMatch(t, []string{"10.0.0.2:80", "10.0.0.3:80"}, got)
+
+	// ip:port filters only apply to shuffled ports, and are ignored otherwise
+	got = processOutput(Options{FileCidr: []string{"10.0.0.0/31"}, FilterIP: []string{"10.0.0.1:80"}})
+	require.Equal(t, []string{"10.0.0.0", "10.0.0.1"}, got)
+	got = processOutput(Options{FileCidr: []string{"10.0.0.0/31"}, Shuffle: true, FilterIP: []string{"10.0.0.1:80"}})
+	require.ElementsMatch(t, []string{"10.0.0.0", "10.0.0.1"}, got)
+	got = processOutput(Options{FileCidr: []string{"10.0.0.0/31"}, Shuffle: true, ShufflePorts: "80", FilterIP: []string{"10.0.0.1:80"}})
+	require.Equal(t, []string{"10.0.0.0:80"}, got)
+}
+
+func TestShufflePortSpec(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr:     []string{"192.168.0.0/31"},
+		Shuffle:      true,
+		ShufflePorts: "ssh,8000-8002,!8001",
+	})
+	require.ElementsMatch(t, []string{
+		"192.168.0.0:22", "192.168.0.0:8000", "192.168.0.0:8002",
+		"192.168.0.1:22", "192.168.0.1:8000", "192.168.0.1:8002",
+	}, got)
+
+	// the ports are a set, whose order doesn't change the shuffled order
+	sorted := processOutput(Options{FileCidr: []string{"192.168.0.0/30"}, Shuffle: true, ShufflePorts: "80,443", Seed: 7})
+	reordered := processOutput(Options{FileCidr: []string{"192.168.0.0/30"}, Shuffle: true, ShufflePorts: "443,80", Seed: 7})
+	require.Equal(t, sorted, reordered)
+}
+
+func TestShufflePerTargetPorts(t *testing.T) {
+	got := processOutput(Options{
+		// as split by the -cidr flag
+		FileCidr: []string{"192.168.0.0/31:80", "443", "10.0.0.0/31:1-2", "[2001:db8::1]:ssh", "172.16.0.1", "[2001:db8::2]:http", "https"},
+		Shuffle:  true,
+	})
+	require.ElementsMatch(t, []string{
+		"192.168.0.0:80", "192.168.0.0:443", "192.168.0.1:80", "192.168.0.1:443",
+		"10.0.0.0:1", "10.0.0.0:2", "10.0.0.1:1", "10.0.0.1:2",
+		"[2001:db8::1]:22",
+		"172.16.0.1",
+		"[2001:db8::2]:80", "[2001:db8::2]:443",
+	}, got)
+
+	got = processOutput(Options{
+		FileCidr:  []string{"[2001:db8::1]:80", "443", "192.168.0.1:80", "443"},
+		Shuffle:   true,
+		FilterIP4: true,
+	})
+	require.ElementsMatch(t, []string{"192.168.0.1:80", "192.168.0.1:443"}, got)
+
+	// the global ports apply to the targets without ports
+	got = processOutput(Options{
+		FileCidr:     []string{"192.168.0.0/31:80", "172.16.0.1"},
+		Shuffle:      true,
+		ShufflePorts: "22",
+	})
+	require.ElementsMatch(t, []string{"192.168.0.0:80", "192.168.0.1:80", "172.16.0.1:22"}, got)
+}
+
+func TestPartition(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr:  []string{"192.168.0.0/30", "192.168.0.4/30", "10.0.0.0/31", "10.0.0.1"},
+		Partition: 2,
+	})
+	require.Equal(t, []string{"1 10.0.0.0/31", "1 192.168.0.0/31", "1 192.168.0.2/32", "2 192.168.0.3/32", "2 192.168.0.4/30"}, got)
+
+	// each group gets its own file
+	output := filepath.Join(t.TempDir(), "targets.txt")
+	got = processOutput(Options{
+		FileCidr:         []string{"192.168.0.0/29"},
+		PartitionWeights: "3,1",
+		Output:           output,
+	})
+	require.Equal(t, []string{"1 192.168.0.0/30", "1 192.168.0.4/31", "2 192.168.0.6/31"}, got)
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(output), "targets-1.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.0/30\n192.168.0.4/31\n", string(data))
+	data, err = os.ReadFile(filepath.Join(filepath.Dir(output), "targets-2.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.6/31\n", string(data))
+
+	// the groups are written in the -notation
+	got = processOutput(Options{
+		FileCidr:         []string{"192.168.0.0/29"},
+		PartitionWeights: "3,1",
+		Output:           output,
+		Notation:         "netmask",
+	})
+	require.Equal(t, []string{"1 192.168.0.0 255.255.255.252", "1 192.168.0.4 255.255.255.254", "2 192.168.0.6 255.255.255.254"}, got)
+	data, err = os.ReadFile(filepath.Join(filepath.Dir(output), "targets-2.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.6 255.255.255.254\n", string(data))
+}
+
+func TestVLSM(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "subnets.txt")
+	require.NoError(t, os.WriteFile(file, []byte("# name hosts\nmgmt 10\nweb: 500\n\ndb,60\n"), 0o600))
+	got := processOutput(Options{
+		FileCidr: []string{"10.0.0.0/22"},
+		VLSM:     file,
+	})
+	require.Equal(t, []string{"web 10.0.0.0/23 10.0.0.1-10.0.1.254 10", "db 10.0.2.0/26 10.0.2.1-10.0.2.62 2", "mgmt 10.0.2.64/28 10.0.2.65-10.0.2.78 4"}, got)
+
+	require.NoError(t, os.WriteFile(file, []byte("web 500 hosts\n"), 0o600))
+	_, err := readSubnetRequests(file)
+	require.Error(t, err)
+}
+
+func TestFreeSpace(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr: []string{"10.0.0.0/22", "2001:db8::/32"},
+		Free:     []string{"10.0.0.0/24", "10.0.2.5", "2001:db8::/33"},
+	})
+	require.Equal(t, []string{"10.0.1.0/24", "10.0.2.0/30", "10.0.2.4/32", "10.0.2.6/31", "10.0.2.8/29", "10.0.2.16/28", "10.0.2.32/27", "10.0.2.64/26", "10.0.2.128/25", "10.0.3.0/24", "2001:db8:8000::/33"}, got)
+
+	got = processOutput(Options{
+		FileCidr: []string{"10.0.0.0/22"},
+		Free:     []string{"10.0.0.0/24", "10.0.2.5"},
+		Range:    true,
+	})
+	require.Equal(t, []string{"10.0.1.0-10.0.2.4", "10.0.2.6-10.0.3.255"}, got)
+
+	got = processOutput(Options{
+		FileCidr: []string{"10.0.0.0/22"},
+		Free:     []string{"10.0.0.0/24", "10.0.2.5"},
+		NextFree: 24,
+	})
+	require.Equal(t, []string{"10.0.1.0/24"}, got)
+}
+
+func TestExcludeSpecialPurpose(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr:       []string{"10.0.0.0/7", "192.168.1.1", "8.8.8.8"},
+		ExcludePrivate: true,
+		Aggregate:      true,
+	})
+	require.Equal(t, []string{"8.8.8.8/32", "11.0.0.0/8"}, got)
+
+	got = processOutput(Options{
+		FileCidr:        []string{"192.0.0.0/29", "192.0.2.0/23", "fe80::/9"},
+		ExcludeReserved: true,
+		Count:           true,
+	})
+	require.Equal(t, []string{"256"}, got)
+
+	// ranges and shuffled targets are filtered as well
+	got = processOutput(Options{
+		FileCidr:   []string{"192.0.0.8-192.0.0.11", "100.64.0.0/31"},
+		OnlyPublic: true,
+		Shuffle:    true,
+	})
+	require.Empty(t, got)
+
+	got = processOutput(Options{
+		FileCidr:      []string{"192.0.0.8-192.0.0.11", "2001:db8::1", "2606:4700::1111"},
+		ExcludeBogons: true,
+	})
+	require.Equal(t, []string{"2606:4700::1111", "192.0.0.9", "192.0.0.10"}, got)
+}
+
+func TestSkipNetworkAndBroadcast(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr:        []string{"10.0.0.0/29", "10.0.1.0/31", "10.0.2.0", "2001:db8::/126"},
+		SkipBaseIP:      true,
+		SkipBroadcastIP: true,
+	})
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.1.0", "10.0.1.1", "10.0.2.0", "2001:db8::1", "2001:db8::2"}, got)
+
+	// the IPs ending in .0 and .255 inside a /23 are hosts
+	got = processOutput(Options{
+		FileCidr:        []string{"10.0.0.0/23"},
+		SkipBaseIP:      true,
+		SkipBroadcastIP: true,
+		Count:           true,
+	})
+	require.Equal(t, []string{"510"}, got)
+
+	// the ends of the input subnet are skipped, not the ends of what the filter leaves
+	got = processOutput(Options{
+		FileCidr:        []string{"10.0.0.128/29"},
+		FilterIP:        []string{"10.0.0.132"},
+		SkipBroadcastIP: true,
+	})
+	require.Equal(t, []string{"10.0.0.128", "10.0.0.129", "10.0.0.130", "10.0.0.131", "10.0.0.133", "10.0.0.134"}, got)
+
+	got = processOutput(Options{
+		FileCidr:      []string{"10.0.0.0/28", "10.0.1.0/30", "10.0.2.0/31"},
+		SkipEnds:      2,
+		SortAscending: true,
+	})
+	require.Equal(t, []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7", "10.0.0.8", "10.0.0.9", "10.0.0.10", "10.0.0.11", "10.0.0.12", "10.0.0.13", "10.0.2.0", "10.0.2.1"}, got)
+
+	// only the ends of a range are skipped, not those of its aligned subnets
+	got = processOutput(Options{
+		FileCidr:        []string{"10.0.0.5-10.0.0.20"},
+		SkipBaseIP:      true,
+		SkipBroadcastIP: true,
+		SortAscending:   true,
+	})
+	require.Equal(t, []string{"10.0.0.6", "10.0.0.7", "10.0.0.8", "10.0.0.9", "10.0.0.10", "10.0.0.11", "10.0.0.12", "10.0.0.13", "10.0.0.14", "10.0.0.15", "10.0.0.16", "10.0.0.17", "10.0.0.18", "10.0.0.19"}, got)
+	got = processOutput(Options{
+		FileCidr: []string{"10.0.0.5-10.0.0.20", "10.0.1.1-10.0.1.2"},
+		SkipEnds: 3,
+		Count:    true,
+	})
+	require.Equal(t, []string{"12"}, got)
+
+	// subnets are output as they are
+	got = processOutput(Options{
+		FileCidr:    []string{"10.0.0.0/24"},
+		SkipBaseIP:  true,
+		SplitPrefix: 25,
+	})
+	require.Equal(t, []string{"10.0.0.0/25", "10.0.0.128/25"}, got)
+}
+
+func TestSubnetInfo(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr: []string{"192.168.1.77/26"},
+		Info:     true,
+	})
+	require.Equal(t, []string{`Address:         192.168.1.77
+Network:         192.168.1.64/26
+Netmask:         255.255.255.192 = 26
+Wildcard:        0.0.0.63
+Broadcast:       192.168.1.127
+HostMin:         192.168.1.65
+HostMax:         192.168.1.126
+Hosts:           62
+Addresses:       64
+Binary:          11000000.10101000.00000001.01 000000
+Class:           C
+Address space:   Private-Use
+Reverse zone:    1.168.192.in-addr.arpa
+`}, got)
+
+	got = processOutput(Options{
+		FileCidr: []string{"2001:db8::1", "10.0.0.0/31"},
+		Info:     true,
+		JSON:     true,
+	})
+	require.Len(t, got, 2)
+	var info mapcidr.SubnetInfo
+	require.NoError(t, json.Unmarshal([]byte(got[0]), &info))
+	require.Equal(t, "2001:db8::1/128", info.Prefix.String())
+	require.Equal(t, "1", info.Hosts.String())
+	require.Equal(t, "2001:0db8:0000:0000:0000:0000:0000:0001", info.Expanded)
+	require.True(t, info.NibbleAligned)
+	var link mapcidr.SubnetInfo
+	require.NoError(t, json.Unmarshal([]byte(got[1]), &link))
+	require.False(t, link.Broadcast.IsValid())
+	require.Equal(t, "2", link.Hosts.String())
+
+	// the hosts are the IPs kept when skipping the ends of the subnet
+	got = processOutput(Options{FileCidr: []string{"2001:db8::/120"}, Info: true, JSON: true})
+	var subnet mapcidr.SubnetInfo
+	require.NoError(t, json.Unmarshal([]byte(got[0]), &subnet))
+	require.Equal(t, "254", subnet.Hosts.String())
+	require.Equal(t, []string{subnet.Hosts.String()}, processOutput(Options{FileCidr: []string{"2001:db8::/120"}, SkipEnds: 1, Count: true}))
+	require.Equal(t, []string{subnet.Hosts.String()}, processOutput(Options{FileCidr: []string{"2001:db8::/120"}, SkipBaseIP: true, SkipBroadcastIP: true, Count: true}))
+
+	// the skip and exclusion options don't split the subnet
+	for _, opts := range []Options{
+		{FileCidr: []string{"10.0.0.0/30"}, Info: true, JSON: true, SkipBaseIP: true},
+		{FileCidr: []string{"10.0.0.0/30"}, Info: true, JSON: true, SkipEnds: 1},
+		{FileCidr: []string{"10.0.0.0/30"}, Info: true, JSON: true, FilterIP: []string{"10.0.0.1"}},
+		{FileCidr: []string{"10.0.0.0/30"}, Info: true, JSON: true, ExcludePrivate: true},
+	} {
+		got = processOutput(opts)
+		require.Len(t, got, 1)
+		require.NoError(t, json.Unmarshal([]byte(got[0]), &subnet))
+		require.Equal(t, "10.0.0.0/30", subnet.Prefix.String())
+	}
+}
+
+func TestMaskNotation(t *testing.T) {
+	got := processOutput(Options{
+		FileCidr:  []string{"192.168.0.0 255.255.255.0", "192.168.1.0/255.255.255.0", "10.0.0.0 0.0.255.255"},
+		Aggregate: true,
+	})
+	require.Equal(t, []string{"10.0.0.0/16", "192.168.0.0/23"}, got)
+
+	got = processOutput(Options{
+		FileCidr: []string{"10.0.0.0 255.255.255.252"},
+		FilterIP: []string{"10.0.0.2 0.0.0.1"},
+	})
+	require.Equal(t, []string{"10.0.0.0", "10.0.0.1"}, got)
+
+	var formatted []string
+	for _, item := range []string{"10.0.0.0/23", "2001:db8::/32", "10.0.0.1", "10.0.0.0-10.0.0.3"} {
+		formatted = append(formatted, formatNotation(item, mapcidr.NotationNetmask))
+	}
+	require.Equal(t, []string{"10.0.0.0 255.255.254.0", "2001:db8::/32", "10.0.0.1", "10.0.0.0-10.0.0.3"}, formatted)
+	require.Equal(t, "10.0.0.0 0.255.255.255", formatNotation("10.0.0.0/8", mapcidr.NotationWildcard))
+	require.Equal(t, "10.0.0.0/8", formatNotation("10.0.0.0/8", mapcidr.NotationCIDR))
+}
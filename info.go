@@ -0,0 +1,155 @@
+package mapcidr
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SubnetInfo describes a subnet the way ipcalc does.
+type SubnetInfo struct {
+	// Address is the address the subnet was given with, which may not be
+	// its network address
+	Address   netip.Addr   `json:"address"`
+	Prefix    netip.Prefix `json:"prefix"`
+	Version   int          `json:"version"`
+	Netmask   netip.Addr   `json:"netmask"`
+	Wildcard  netip.Addr   `json:"wildcard"`
+	Network   netip.Addr   `json:"network"`
+	Broadcast netip.Addr   `json:"broadcast,omitzero"`
+	// FirstHost and LastHost are the ends of the usable host addresses,
+	// which exclude the first and last addresses of the subnet as
+	// PrefixHostRange does
+	FirstHost netip.Addr `json:"first_host"`
+	LastHost  netip.Addr `json:"last_host"`
+	Addresses *big.Int   `json:"addresses"`
+	Hosts     *big.Int   `json:"hosts"`
+	// Binary is the network address in binary, with a space after the
+	// prefix bits
+	Binary string `json:"binary"`
+	// Class is the classful network class of an IPv4 subnet, A to E
+	Class string `json:"class,omitempty"`
+	// AddressSpace is the name of the special-purpose registry block
+	// containing all the addresses of the subnet, if any
+	AddressSpace string `json:"address_space,omitempty"`
+	// Expanded is the IPv6 network address with all its digits
+	Expanded string `json:"expanded,omitempty"`
+	// NibbleAligned reports whether the length of an IPv6 prefix is a
+	// multiple of 4, so that the subnet has its own reverse zone
+	NibbleAligned bool `json:"nibble_aligned,omitempty"`
+	// ReverseZone is the most specific reverse DNS zone containing the
+	// subnet
+	ReverseZone string `json:"reverse_zone"`
+}
+
+// NewSubnetInfo returns the information about the subnet of the prefix.
+// Its hosts are the addresses of PrefixHostRange without the network and
+// broadcast addresses, the first and last ones, for IPv6 as well. Following
+// RFC 3021, subnets of at most two addresses, such as /31 and /32, have no
+// broadcast address and all their addresses are hosts. IPv6 subnets have no
+// broadcast address either.
+func NewSubnetInfo(prefix netip.Prefix) (SubnetInfo, error) {
+	if !prefix.IsValid() {
+		return SubnetInfo{}, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	network := IPNetFromPrefix(prefix)
+	firstIP, lastIP, err := AddressRange(network)
+	if err != nil {
+		return SubnetInfo{}, err
+	}
+	first, _ := AddrFromIP(firstIP)
+	last, _ := AddrFromIP(lastIP)
+	hosts := PrefixHostRange(prefix, true, true)
+
+	info := SubnetInfo{
+		Address:     prefix.Addr(),
+		Prefix:      prefix.Masked(),
+		Version:     6,
+		Netmask:     prefixNetmask(prefix),
+		Wildcard:    prefixWildcard(prefix),
+		Network:     first,
+		FirstHost:   hosts.First,
+		LastHost:    hosts.Last,
+		Addresses:   CountIPsInCIDR(true, true, network),
+		Hosts:       CountIPsInCIDR(false, false, network),
+		Binary:      binaryPrefix(prefix.Masked()),
+		ReverseZone: reverseZone(prefix.Masked()),
+	}
+	if prefix.Addr().Is4() {
+		info.Version = 4
+		if prefix.Addr().BitLen()-prefix.Bits() > 1 {
+			info.Broadcast = last
+		}
+		info.Class = addressClass(first)
+	} else {
+		info.Expanded = first.StringExpanded()
+		info.NibbleAligned = prefix.Bits()%4 == 0
+	}
+	if classifications := Classify(prefix); len(classifications) > 0 && !classifications[0].Partial {
+		info.AddressSpace = classifications[0].Block.Name
+	}
+	return info, nil
+}
+
+// binaryPrefix returns the address of the prefix in binary, with the bytes
+// of IPv4 addresses separated by dots and the groups of IPv6 addresses by
+// colons, and a space after the prefix bits.
+func binaryPrefix(prefix netip.Prefix) string {
+	separator, groupBits := ".", 8
+	if prefix.Addr().Is6() {
+		separator, groupBits = ":", 16
+	}
+	var sb strings.Builder
+	for i, b := range prefix.Addr().AsSlice() {
+		for j := range 8 {
+			bit := i*8 + j
+			if bit > 0 && bit%groupBits == 0 {
+				sb.WriteString(separator)
+			}
+			if bit > 0 && bit == prefix.Bits() {
+				sb.WriteByte(' ')
+			}
+			sb.WriteByte('0' + b>>(7-j)&1)
+		}
+	}
+	return sb.String()
+}
+
+// reverseZone returns the reverse DNS zone of the longest prefix with
+// whole labels containing the prefix: octets for IPv4 and nibbles for IPv6.
+func reverseZone(prefix netip.Prefix) string {
+	var labels []string
+	if prefix.Addr().Is4() {
+		for _, b := range prefix.Addr().AsSlice()[:prefix.Bits()/8] {
+			labels = append(labels, strconv.Itoa(int(b)))
+		}
+		slices.Reverse(labels)
+		return strings.Join(append(labels, "in-addr.arpa"), ".")
+	}
+	a16 := prefix.Addr().As16()
+	for i := range prefix.Bits() / 4 {
+		labels = append(labels, strconv.FormatUint(uint64(a16[i/2]>>(4*(1-i%2))&0xf), 16))
+	}
+	slices.Reverse(labels)
+	return strings.Join(append(labels, "ip6.arpa"), ".")
+}
+
+// addressClass returns the class of the IPv4 address in the classful
+// network architecture of RFC 791 and RFC 1112.
+func addressClass(addr netip.Addr) string {
+	switch first := addr.As4()[0]; {
+	case first < 128:
+		return "A"
+	case first < 192:
+		return "B"
+	case first < 224:
+		return "C"
+	case first < 240:
+		return "D"
+	default:
+		return "E"
+	}
+}
@@ -0,0 +1,86 @@
+package mapcidr
+
+import (
+	"encoding/json"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSubnetInfo(t *testing.T) {
+	info, err := NewSubnetInfo(netip.MustParsePrefix("192.168.1.77/26"))
+	require.NoError(t, err)
+	require.Equal(t, "192.168.1.77", info.Address.String())
+	require.Equal(t, "192.168.1.64/26", info.Prefix.String())
+	require.Equal(t, 4, info.Version)
+	require.Equal(t, "255.255.255.192", info.Netmask.String())
+	require.Equal(t, "0.0.0.63", info.Wildcard.String())
+	require.Equal(t, "192.168.1.64", info.Network.String())
+	require.Equal(t, "192.168.1.127", info.Broadcast.String())
+	require.Equal(t, "192.168.1.65", info.FirstHost.String())
+	require.Equal(t, "192.168.1.126", info.LastHost.String())
+	require.Equal(t, "64", info.Addresses.String())
+	require.Equal(t, "62", info.Hosts.String())
+	require.Equal(t, "11000000.10101000.00000001.01 000000", info.Binary)
+	require.Equal(t, "C", info.Class)
+	require.Equal(t, "Private-Use", info.AddressSpace)
+	require.Equal(t, "1.168.192.in-addr.arpa", info.ReverseZone)
+
+	// point-to-point links have neither network nor broadcast addresses
+	info, err = NewSubnetInfo(netip.MustParsePrefix("10.0.0.0/31"))
+	require.NoError(t, err)
+	require.False(t, info.Broadcast.IsValid())
+	require.Equal(t, "10.0.0.0-10.0.0.1", IPRange{First: info.FirstHost, Last: info.LastHost}.String())
+	require.Equal(t, "2", info.Hosts.String())
+	require.Equal(t, "A", info.Class)
+
+	info, err = NewSubnetInfo(netip.MustParsePrefix("0.0.0.0/0"))
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0", info.Netmask.String())
+	require.Equal(t, "00000000.00000000.00000000.00000000", info.Binary)
+	require.Empty(t, info.AddressSpace)
+	require.Equal(t, "in-addr.arpa", info.ReverseZone)
+
+	info, err = NewSubnetInfo(netip.MustParsePrefix("2001:db8:abcd:12::1/62"))
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:abcd:10::/62", info.Prefix.String())
+	require.Equal(t, 6, info.Version)
+	require.Equal(t, "ffff:ffff:ffff:fffc::", info.Netmask.String())
+	require.Equal(t, "::3:ffff:ffff:ffff:ffff", info.Wildcard.String())
+	require.False(t, info.Broadcast.IsValid())
+	require.Equal(t, "2001:db8:abcd:10::1", info.FirstHost.String())
+	require.Equal(t, "2001:db8:abcd:13:ffff:ffff:ffff:fffe", info.LastHost.String())
+	require.Equal(t, "73786976294838206464", info.Addresses.String())
+	require.Equal(t, "73786976294838206462", info.Hosts.String())
+	require.Equal(t, "0010000000000001:0000110110111000:1010101111001101:00000000000100 00:0000000000000000:0000000000000000:0000000000000000:0000000000000000", info.Binary)
+	require.Equal(t, "2001:0db8:abcd:0010:0000:0000:0000:0000", info.Expanded)
+	require.False(t, info.NibbleAligned)
+	require.Equal(t, "Documentation", info.AddressSpace)
+	require.Equal(t, "1.0.0.d.c.b.a.8.b.d.0.1.0.0.2.ip6.arpa", info.ReverseZone)
+	require.Empty(t, info.Class)
+
+	// the hosts are the addresses the skip options keep
+	_, network, _ := net.ParseCIDR("2001:db8:abcd:10::/62")
+	require.Equal(t, PrefixHostRange(info.Prefix, true, true).Size(), info.Hosts)
+	require.Equal(t, CountIPsInCIDRs(false, false, network), info.Hosts)
+
+	info, err = NewSubnetInfo(netip.MustParsePrefix("2001:db8::/127"))
+	require.NoError(t, err)
+	require.Equal(t, "2", info.Hosts.String())
+	require.Equal(t, "2001:db8::", info.FirstHost.String())
+
+	info, err = NewSubnetInfo(netip.MustParsePrefix("2001:db8::/32"))
+	require.NoError(t, err)
+	require.True(t, info.NibbleAligned)
+	require.Equal(t, "8.b.d.0.1.0.0.2.ip6.arpa", info.ReverseZone)
+
+	data, err := json.Marshal(info)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"prefix":"2001:db8::/32"`)
+	require.NotContains(t, string(data), `"broadcast"`)
+
+	_, err = NewSubnetInfo(netip.Prefix{})
+	require.Error(t, err)
+}
@@ -26,14 +26,15 @@ const (
 )
 
 // CountIPsInCIDR takes a RFC4632/RFC4291-formatted IPv4/IPv6 CIDR and
-// determines how many IP addresses reside within that CIDR.
-// Returns 0 if the input CIDR cannot be parsed.
+// determines how many IP addresses reside within that CIDR, with or without
+// its network and broadcast addresses. As per RFC 3021, /31 and /32 CIDRs
+// (/127 and /128 for IPv6) have neither, and are counted whole.
 func CountIPsInCIDR(includeBase, includeBroadcast bool, ipnet *net.IPNet) *big.Int {
 	subnet, size := ipnet.Mask.Size()
-	if subnet == size {
-		return big.NewInt(1)
-	}
 	numberOfIps := big.NewInt(2).Exp(big.NewInt(2), big.NewInt(int64(size-subnet)), nil)
+	if size-subnet <= 1 {
+		return numberOfIps
+	}
 	if !includeBase {
 		numberOfIps = numberOfIps.Sub(numberOfIps, big.NewInt(1))
 	}
@@ -123,150 +124,24 @@ func (s NetsByRange) Len() int {
 	return len(s)
 }
 
-// RemoveCIDRs removes the specified CIDRs from another set of CIDRs. If a CIDR
-// to remove is not contained within the CIDR, the CIDR to remove is ignored. A
-// slice of CIDRs is returned which contains the set of CIDRs provided minus
-// the set of CIDRs which  were removed. Both input slices may be modified by
-// calling this function.
+// RemoveCIDRs removes the specified CIDRs from another set of CIDRs. A sorted
+// minimal slice of CIDRs is returned which contains the set of CIDRs provided
+// minus the set of CIDRs which were removed. IPv4 and IPv6 CIDRs may be mixed
+// in both lists, and the input slices are not modified.
 func RemoveCIDRs(allowCIDRs, removeCIDRs []*net.IPNet) ([]*net.IPNet, error) {
-	// Ensure that we iterate through the provided CIDRs in order of largest
-	// subnet first.
-	sort.Sort(NetsByMask(removeCIDRs))
-
-PreLoop:
-	// Remove CIDRs which are contained within CIDRs that we want to remove;
-	// such CIDRs are redundant.
-	for j, removeCIDR := range removeCIDRs {
-		for i, removeCIDR2 := range removeCIDRs {
-			if i == j {
-				continue
-			}
-			if removeCIDR.Contains(removeCIDR2.IP) {
-				removeCIDRs = append(removeCIDRs[:i], removeCIDRs[i+1:]...)
-				// Re-trigger loop since we have modified the slice we are iterating over.
-				goto PreLoop
-			}
-		}
-	}
-
-	for _, remove := range removeCIDRs {
-	Loop:
-		for i, allowCIDR := range allowCIDRs {
-			// Don't allow comparison of different address spaces.
-			if allowCIDR.IP.To4() != nil && remove.IP.To4() == nil ||
-				allowCIDR.IP.To4() == nil && remove.IP.To4() != nil {
-				return nil, fmt.Errorf("cannot mix IP addresses of different IP protocol versions")
-			}
-
-			// Only remove CIDR if it is contained in the subnet we are allowing.
-			if allowCIDR.Contains(remove.IP.Mask(remove.Mask)) {
-				nets, err := removeCIDR(allowCIDR, remove)
-				if err != nil {
-					return nil, err
-				}
-
-				// Remove CIDR that we have just processed and append new CIDRs
-				// that we computed from removing the CIDR to remove.
-				allowCIDRs = append(allowCIDRs[:i], allowCIDRs[i+1:]...)
-				allowCIDRs = append(allowCIDRs, nets...)
-				goto Loop
-			} else if remove.Contains(allowCIDR.IP.Mask(allowCIDR.Mask)) {
-				// If a CIDR that we want to remove contains a CIDR in the list
-				// that is allowed, then we can just remove the CIDR to allow.
-				allowCIDRs = append(allowCIDRs[:i], allowCIDRs[i+1:]...)
-				goto Loop
-			}
-		}
-	}
-
-	return allowCIDRs, nil
-}
-
-func removeCIDR(allowCIDR, removeCIDR *net.IPNet) ([]*net.IPNet, error) {
-	var allowIsIpv4, removeIsIpv4 bool
-	var allowBitLen int
-
-	if allowCIDR.IP.To4() != nil {
-		allowIsIpv4 = true
-		allowBitLen = ipv4BitLen
-	} else {
-		allowBitLen = ipv6BitLen
-	}
-
-	if removeCIDR.IP.To4() != nil {
-		removeIsIpv4 = true
-	}
-
-	if removeIsIpv4 != allowIsIpv4 {
-		return nil, fmt.Errorf("cannot mix IP addresses of different IP protocol versions")
-	}
-
-	// Get size of each CIDR mask.
-	allowSize, _ := allowCIDR.Mask.Size()
-	removeSize, _ := removeCIDR.Mask.Size()
-
-	if allowSize > removeSize {
-		return nil, fmt.Errorf("allow CIDR prefix must be a superset of "+
-			"remove CIDR prefix")
-	}
-
-	allowFirstIPMasked := allowCIDR.IP.Mask(allowCIDR.Mask)
-	removeFirstIPMasked := removeCIDR.IP.Mask(removeCIDR.Mask)
-
-	// Convert to IPv4 in IPv6 addresses if needed.
-	if allowIsIpv4 {
-		allowFirstIPMasked = append(v4Mappedv6Prefix, allowFirstIPMasked...)
+	allowPrefixes, err := PrefixesFromIPNets(allowCIDRs)
+	if err != nil {
+		return nil, err
 	}
-
-	if removeIsIpv4 {
-		removeFirstIPMasked = append(v4Mappedv6Prefix, removeFirstIPMasked...)
+	removePrefixes, err := PrefixesFromIPNets(removeCIDRs)
+	if err != nil {
+		return nil, err
 	}
-
-	allowFirstIP := &allowFirstIPMasked
-	removeFirstIP := &removeFirstIPMasked
-
-	// Create CIDR prefixes with mask size of Y+1, Y+2 ... X where Y is the mask
-	// length of the CIDR prefix B from which we are excluding a CIDR prefix A
-	// with mask length X.
-	allows := make([]*net.IPNet, 0, removeSize-allowSize)
-	for i := (allowBitLen - allowSize - 1); i >= (allowBitLen - removeSize); i-- {
-		// The mask for each CIDR prefix is simply the ith bit flipped, and then
-		// zero'ing out all subsequent bits (the host identifier part of the
-		// prefix).
-		newMaskSize := allowBitLen - i
-		newIP := (*net.IP)(flipNthBit((*[]byte)(removeFirstIP), uint(i)))
-		for k := range *allowFirstIP {
-			(*newIP)[k] = (*allowFirstIP)[k] | (*newIP)[k]
-		}
-
-		newMask := net.CIDRMask(newMaskSize, allowBitLen)
-		newIPMasked := newIP.Mask(newMask)
-
-		newIPNet := net.IPNet{IP: newIPMasked, Mask: newMask}
-		allows = append(allows, &newIPNet)
+	prefixes, err := RemovePrefixes(allowPrefixes, removePrefixes)
+	if err != nil {
+		return nil, err
 	}
-
-	return allows, nil
-}
-
-func getByteIndexOfBit(bit uint) uint {
-	return net.IPv6len - (bit / 8) - 1
-}
-
-// func getNthBit(ip *net.IP, bitNum uint) uint8 {
-// 	byteNum := getByteIndexOfBit(bitNum)
-// 	bits := (*ip)[byteNum]
-// 	b := uint8(bits)
-// 	return b >> (bitNum % 8) & 1
-// }
-
-func flipNthBit(ip *[]byte, bitNum uint) *[]byte {
-	ipCopy := make([]byte, len(*ip))
-	copy(ipCopy, *ip)
-	byteNum := getByteIndexOfBit(bitNum)
-	ipCopy[byteNum] ^= 1 << (bitNum % 8)
-
-	return &ipCopy
+	return IPNetsFromPrefixes(prefixes), nil
 }
 
 func ipNetToRange(ipNet net.IPNet) netWithRange {
@@ -1134,82 +1009,41 @@ The intent here is to get the CIDR range from the IP range.
 This function will return the sorted list of CIDR ranges.
 */
 func GetCIDRFromIPRange(firstIP, lastIP net.IP) ([]*net.IPNet, error) {
-	// check if range is valid or not
-	if bytes.Compare(firstIP, lastIP) > 0 {
-		return nil, fmt.Errorf("start IP:%s must be less than End IP:%s", firstIP, lastIP)
+	first, ok := AddrFromIP(firstIP)
+	if !ok {
+		return nil, ParseIPError
 	}
-	cidrs := rangeToCIDRs(firstIP, lastIP)
-	sort.Slice(cidrs, func(i, j int) bool {
-		return bytes.Compare(cidrs[i].IP, cidrs[j].IP) < 0
-	})
-	return cidrs, nil
+	last, ok := AddrFromIP(lastIP)
+	if !ok {
+		return nil, ParseIPError
+	}
+	prefixes, err := PrefixesFromRange(first, last)
+	if err != nil {
+		return nil, err
+	}
+	return IPNetsFromPrefixes(prefixes), nil
 }
 
+// IpRangeToCIDR returns the minimal list of CIDRs covering the range from
+// start to end, IPv4 or IPv6.
 func IpRangeToCIDR(start, end string) ([]string, error) {
-	ips, err := netip.ParseAddr(start)
+	first, err := netip.ParseAddr(start)
 	if err != nil {
 		return nil, err
 	}
-	ipe, err := netip.ParseAddr(end)
+	last, err := netip.ParseAddr(end)
 	if err != nil {
 		return nil, err
 	}
-
-	isV4 := ips.Is4()
-	if isV4 != ipe.Is4() {
-		return nil, errors.New("start and end types are different")
-	}
-	if ips.Compare(ipe) > 0 {
-		return nil, errors.New("start > end")
-	}
-
-	var (
-		ipsInt = new(big.Int).SetBytes(ips.AsSlice())
-		ipeInt = new(big.Int).SetBytes(ipe.AsSlice())
-		nextIp = new(big.Int)
-		maxBit = new(big.Int)
-		cmpSh  = new(big.Int)
-		bits   = new(big.Int)
-		mask   = new(big.Int)
-		one    = big.NewInt(1)
-		buf    []byte
-		cidr   []string
-		bitSh  uint
-	)
-	if isV4 {
-		maxBit.SetUint64(32)
-		buf = make([]byte, 4)
-	} else {
-		maxBit.SetUint64(128)
-		buf = make([]byte, 16)
-	}
-
-	for {
-		bits.SetUint64(1)
-		mask.SetUint64(1)
-		for bits.Cmp(maxBit) < 0 {
-			nextIp.Or(ipsInt, mask)
-
-			bitSh = uint(bits.Uint64())
-			cmpSh.Lsh(cmpSh.Rsh(ipsInt, bitSh), bitSh)
-			if (nextIp.Cmp(ipeInt) > 0) || (cmpSh.Cmp(ipsInt) != 0) {
-				bits.Sub(bits, one)
-				mask.Rsh(mask, 1)
-				break
-			}
-			bits.Add(bits, one)
-			mask.Add(mask.Lsh(mask, 1), one)
-		}
-
-		addr, _ := netip.AddrFromSlice(ipsInt.FillBytes(buf))
-		cidr = append(cidr, addr.String()+"/"+bits.Sub(maxBit, bits).String())
-
-		if nextIp.Or(ipsInt, mask); nextIp.Cmp(ipeInt) >= 0 {
-			break
-		}
-		ipsInt.Add(nextIp, one)
+	prefixes, err := PrefixesFromRange(first, last)
+	if err != nil {
+		return nil, err
 	}
-	return cidr, nil
+	cidrs := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		cidrs = append(cidrs, prefix.String())
+	}
+	return cidrs, nil
 }
 
 /*
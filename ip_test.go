@@ -17,6 +17,12 @@ func TestCountIPsInCIDRs(t *testing.T) {
 	require.Equal(t, CountIPsInCIDRs(false, false, net1, net2), big.NewInt(4092), errorMsg)
 	require.Equal(t, CountIPsInCIDRs(true, false, net1, net2), big.NewInt(4094), errorMsg)
 	require.Equal(t, CountIPsInCIDRs(false, true, net1, net2), big.NewInt(4094), errorMsg)
+
+	// RFC 3021 point-to-point links have neither network nor broadcast IPs
+	_, net3, _ := net.ParseCIDR("10.0.0.0/31")
+	_, net4, _ := net.ParseCIDR("2001:db8::1/128")
+	require.Equal(t, big.NewInt(2), CountIPsInCIDR(false, false, net3), errorMsg)
+	require.Equal(t, big.NewInt(1), CountIPsInCIDR(false, false, net4), errorMsg)
 }
 
 func TestIpEncodings(t *testing.T) {
@@ -0,0 +1,273 @@
+package mapcidr
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IPRange represents an inclusive range of IP addresses belonging to the
+// same address family.
+type IPRange struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+// ParseRange parses a range of addresses written as "first-last", with
+// optional spaces around the dash, e.g. "192.168.0.1-192.168.0.10" or
+// "2001:db8::1 - 2001:db8::ff". The last address may be shortened to its
+// last octet for IPv4 ("192.168.0.1-10") or its last group for IPv6
+// ("2001:db8::1-ff").
+func ParseRange(s string) (IPRange, error) {
+	left, right, ok := strings.Cut(s, "-")
+	if !ok {
+		return IPRange{}, fmt.Errorf("invalid IP range %q: missing '-'", s)
+	}
+	first, err := netip.ParseAddr(strings.TrimSpace(left))
+	if err != nil {
+		return IPRange{}, fmt.Errorf("invalid IP range %q: %w", s, err)
+	}
+	first = first.Unmap()
+
+	right = strings.TrimSpace(right)
+	last, err := netip.ParseAddr(right)
+	if err != nil {
+		if last, err = expandRangeShorthand(first, right); err != nil {
+			return IPRange{}, fmt.Errorf("invalid IP range %q: %w", s, err)
+		}
+	}
+	r := IPRange{First: first, Last: last.Unmap()}
+	if err := r.validate(); err != nil {
+		return IPRange{}, err
+	}
+	return r, nil
+}
+
+// expandRangeShorthand returns first with its last octet, or last group for
+// IPv6, replaced by the given number.
+func expandRangeShorthand(first netip.Addr, s string) (netip.Addr, error) {
+	if first.Is4() {
+		octet, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("invalid last octet %q", s)
+		}
+		b := first.As4()
+		b[3] = byte(octet)
+		return netip.AddrFrom4(b), nil
+	}
+	group, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid last group %q", s)
+	}
+	b := first.As16()
+	b[14], b[15] = byte(group>>8), byte(group)
+	return netip.AddrFrom16(b).WithZone(first.Zone()), nil
+}
+
+// validate returns the reason why the range is not valid, if any.
+func (r IPRange) validate() error {
+	switch {
+	case !r.First.IsValid() || !r.Last.IsValid():
+		return errors.New("invalid IP address")
+	case r.First.Is4() != r.Last.Is4():
+		return errors.New("start and end types are different")
+	case r.First.Compare(r.Last) > 0:
+		return fmt.Errorf("start IP:%s must be less than End IP:%s", r.First, r.Last)
+	}
+	return nil
+}
+
+// String returns the range as "first-last".
+func (r IPRange) String() string {
+	return r.First.String() + "-" + r.Last.String()
+}
+
+// Contains reports whether the range contains addr.
+func (r IPRange) Contains(addr netip.Addr) bool {
+	return r.IsValid() && addr.Is4() == r.First.Is4() &&
+		r.First.Compare(addr) <= 0 && addr.Compare(r.Last) <= 0
+}
+
+// Overlaps reports whether the ranges have at least one address in common.
+func (r IPRange) Overlaps(o IPRange) bool {
+	return r.IsValid() && o.IsValid() && r.First.Is4() == o.First.Is4() &&
+		r.First.Compare(o.Last) <= 0 && o.First.Compare(r.Last) <= 0
+}
+
+// Size returns the number of addresses in the range, or zero if the range is
+// not valid.
+func (r IPRange) Size() *big.Int {
+	if !r.IsValid() {
+		return new(big.Int)
+	}
+	size := u128FromAddr(r.Last).sub(u128FromAddr(r.First)).big()
+	return size.Add(size, big.NewInt(1))
+}
+
+// IsValid reports whether both ends of the range are valid addresses of the
+// same family and First is not greater than Last.
+func (r IPRange) IsValid() bool {
+	return r.First.IsValid() && r.Last.IsValid() &&
+		r.First.Is4() == r.Last.Is4() &&
+		r.First.Compare(r.Last) <= 0
+}
+
+// Trim returns the range without its first head and last tail addresses.
+// The second result is false if no address is left.
+func (r IPRange) Trim(head, tail uint64) (IPRange, bool) {
+	if !r.IsValid() {
+		return IPRange{}, false
+	}
+	first, overflow := u128FromAddr(r.First).addOverflow(uint128{lo: head})
+	last := u128FromAddr(r.Last)
+	if overflow || first.cmp(last) > 0 || last.sub(first).cmp(uint128{lo: tail}) < 0 {
+		return IPRange{}, false
+	}
+	is4 := r.First.Is4()
+	return IPRange{First: first.addr(is4), Last: last.sub(uint128{lo: tail}).addr(is4)}, true
+}
+
+// Prefixes returns the minimal sorted list of prefixes covering the range.
+// It returns nil if the range is not valid.
+func (r IPRange) Prefixes() []netip.Prefix {
+	if !r.IsValid() {
+		return nil
+	}
+	return appendRangePrefixes(nil, r)
+}
+
+// SplitRangeBalanced splits the range into n contiguous chunks whose
+// address counts differ by at most one, the larger chunks first. It fails if
+// the range has less than n addresses.
+func SplitRangeBalanced(r IPRange, n int) ([]IPRange, error) {
+	if !r.IsValid() {
+		return nil, fmt.Errorf("invalid IP range %s", r)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of chunks %d", n)
+	}
+	first, last := u128FromAddr(r.First), u128FromAddr(r.Last)
+	// divide the size minus one, as the size of ::/0 doesn't fit in 128 bits
+	quotient, remainder := last.sub(first).divMod64(uint64(n))
+	if remainder++; remainder == uint64(n) {
+		quotient, remainder = quotient.addOne(), 0
+	}
+	if quotient.isZero() {
+		return nil, fmt.Errorf("cannot split %s into %d chunks, it has only %d addresses", r, n, remainder)
+	}
+
+	is4 := r.First.Is4()
+	chunks := make([]IPRange, 0, n)
+	for i := uint64(0); i < uint64(n); i++ {
+		// chunk size minus one
+		size := quotient.subOne()
+		if i < remainder {
+			size = quotient
+		}
+		end := first.add(size)
+		chunks = append(chunks, IPRange{First: first.addr(is4), Last: end.addr(is4)})
+		first = end.addOne()
+	}
+	return chunks, nil
+}
+
+// appendRangePrefixes appends to dst the minimal list of aligned prefixes
+// covering r, which must be valid.
+func appendRangePrefixes(dst []netip.Prefix, r IPRange) []netip.Prefix {
+	is4 := r.First.Is4()
+	familyBits := r.First.BitLen()
+	cur, last := u128FromAddr(r.First), u128FromAddr(r.Last)
+	for {
+		// take the largest block aligned on cur which doesn't pass last
+		hostBits := cur.trailingZeros()
+		if hostBits > familyBits {
+			hostBits = familyBits
+		}
+		for hostBits > 0 && cur.add(hostMask(hostBits)).cmp(last) > 0 {
+			hostBits--
+		}
+		dst = append(dst, netip.PrefixFrom(cur.addr(is4), familyBits-hostBits))
+
+		blockLast := cur.add(hostMask(hostBits))
+		if blockLast.cmp(last) >= 0 {
+			return dst
+		}
+		cur = blockLast.addOne()
+	}
+}
+
+// prefixRange returns the first and last address of the prefix as integers.
+func prefixRange(prefix netip.Prefix) (first, last uint128) {
+	first = u128FromAddr(prefix.Masked().Addr())
+	last = first.or(hostMask(prefix.Addr().BitLen() - prefix.Bits()))
+	return first, last
+}
+
+// MergeRanges sorts the ranges and joins the overlapping or adjacent ones,
+// dropping the invalid ones. The returned ranges are sorted with IPv4 before
+// IPv6. The input slice is not modified.
+func MergeRanges(ranges []IPRange) []IPRange {
+	sorted := make([]IPRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.IsValid() {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].First.Less(sorted[j].First)
+	})
+
+	merged := sorted[:0]
+	for _, r := range sorted {
+		if len(merged) > 0 {
+			prev := &merged[len(merged)-1]
+			if prev.Last.Is4() == r.First.Is4() && (r.First.Compare(prev.Last) <= 0 || prev.Last.Next() == r.First) {
+				if r.Last.Compare(prev.Last) > 0 {
+					prev.Last = r.Last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// addrSpace lays out sorted, non-overlapping ranges one after another so
+// that every address can be picked by its index.
+type addrSpace struct {
+	ranges []IPRange
+	// offsets holds the index of the first address of each range
+	offsets []uint128
+	size    uint128
+}
+
+// newAddrSpace indexes the ranges, which must be valid, sorted and
+// non-overlapping. Addresses past the maximum uint128 index are dropped.
+func newAddrSpace(ranges []IPRange) addrSpace {
+	space := addrSpace{ranges: ranges, offsets: make([]uint128, len(ranges))}
+	for i, r := range ranges {
+		space.offsets[i] = space.size
+		rangeSize := u128FromAddr(r.Last).sub(u128FromAddr(r.First)).addOne()
+		var overflow bool
+		if space.size, overflow = space.size.addOverflow(rangeSize); overflow || rangeSize.isZero() {
+			space.size = max128
+			space.ranges, space.offsets = ranges[:i+1], space.offsets[:i+1]
+			break
+		}
+	}
+	return space
+}
+
+// at returns the address at index, which must be less than the space size.
+func (s addrSpace) at(index uint128) netip.Addr {
+	i := sort.Search(len(s.offsets), func(i int) bool {
+		return s.offsets[i].cmp(index) > 0
+	}) - 1
+	r := s.ranges[i]
+	return u128FromAddr(r.First).add(index.sub(s.offsets[i])).addr(r.First.Is4())
+}
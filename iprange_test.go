@@ -0,0 +1,123 @@
+package mapcidr
+
+import (
+	"math/big"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, tt := range []struct{ input, want string }{
+		{"192.168.0.1-192.168.0.10", "192.168.0.1-192.168.0.10"},
+		{"192.168.0.1 - 192.168.0.10", "192.168.0.1-192.168.0.10"},
+		{"192.168.0.1-10", "192.168.0.1-192.168.0.10"},
+		{"2001:db8::1-2001:db8::1:0", "2001:db8::1-2001:db8::1:0"},
+		{"2001:db8::1-ff", "2001:db8::1-2001:db8::ff"},
+		{"::ffff:10.0.0.1-10.0.0.2", "10.0.0.1-10.0.0.2"},
+	} {
+		r, err := ParseRange(tt.input)
+		require.NoError(t, err, tt.input)
+		require.Equal(t, tt.want, r.String())
+	}
+
+	for _, input := range []string{"192.168.0.1", "192.168.0.10-192.168.0.1", "192.168.0.1-256", "10.0.0.1-::1", "foo-bar", "2001:db8::10-1"} {
+		_, err := ParseRange(input)
+		require.Error(t, err, input)
+	}
+}
+
+func TestIPRange(t *testing.T) {
+	r, err := ParseRange("10.0.0.1-10.0.0.6")
+	require.NoError(t, err)
+	require.True(t, r.Contains(netip.MustParseAddr("10.0.0.6")))
+	require.False(t, r.Contains(netip.MustParseAddr("10.0.0.7")))
+	require.False(t, r.Contains(netip.MustParseAddr("::ffff:10.0.0.2")))
+	require.Equal(t, big.NewInt(6), r.Size())
+	require.Equal(t, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}, prefixStrings(r.Prefixes()))
+
+	other, _ := ParseRange("10.0.0.6-10.0.0.9")
+	require.True(t, r.Overlaps(other))
+	other, _ = ParseRange("10.0.0.7-10.0.0.9")
+	require.False(t, r.Overlaps(other))
+
+	all := PrefixRange(netip.MustParsePrefix("::/0"))
+	require.Equal(t, new(big.Int).Lsh(big.NewInt(1), 128), all.Size())
+
+	merged := MergeRanges([]IPRange{other, all, r, {}})
+	require.Equal(t, []string{"10.0.0.1-10.0.0.9", "::-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}, []string{merged[0].String(), merged[1].String()})
+}
+
+func TestIPRangeTrim(t *testing.T) {
+	r, _ := ParseRange("10.0.0.0-10.0.0.7")
+	trimmed, ok := r.Trim(2, 1)
+	require.True(t, ok)
+	require.Equal(t, "10.0.0.2-10.0.0.6", trimmed.String())
+	trimmed, ok = r.Trim(4, 3)
+	require.True(t, ok)
+	require.Equal(t, "10.0.0.4-10.0.0.4", trimmed.String())
+	_, ok = r.Trim(4, 4)
+	require.False(t, ok)
+	_, ok = PrefixRange(netip.MustParsePrefix("::/0")).Trim(1<<63, 1<<63)
+	require.True(t, ok)
+	_, ok = PrefixRange(netip.MustParsePrefix("ffff::/16")).Trim(^uint64(0), 0)
+	require.True(t, ok)
+	_, ok = PrefixRange(netip.MustParsePrefix("255.255.255.255/32")).Trim(1, 0)
+	require.False(t, ok)
+	_, ok = IPRange{}.Trim(0, 0)
+	require.False(t, ok)
+}
+
+func TestIpRangeToCIDR(t *testing.T) {
+	cidrs, err := IpRangeToCIDR("2001:db8::1", "2001:db8::6")
+	require.NoError(t, err)
+	require.Equal(t, []string{"2001:db8::1/128", "2001:db8::2/127", "2001:db8::4/127", "2001:db8::6/128"}, cidrs)
+
+	_, err = IpRangeToCIDR("10.0.0.2", "10.0.0.1")
+	require.Error(t, err)
+}
+
+func TestSplitRangeBalanced(t *testing.T) {
+	rangeStrings := func(ranges []IPRange) []string {
+		var s []string
+		for _, r := range ranges {
+			s = append(s, r.String())
+		}
+		return s
+	}
+
+	chunks, err := SplitPrefixBalanced(netip.MustParsePrefix("10.0.0.0/24"), 5)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0-10.0.0.51", "10.0.0.52-10.0.0.102", "10.0.0.103-10.0.0.153", "10.0.0.154-10.0.0.204", "10.0.0.205-10.0.0.255"}, rangeStrings(chunks))
+	require.Equal(t, []string{"10.0.0.0/27", "10.0.0.32/28", "10.0.0.48/30"}, prefixStrings(chunks[0].Prefixes()))
+
+	r, _ := ParseRange("10.0.0.1-10.0.0.3")
+	chunks, err = SplitRangeBalanced(r, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1-10.0.0.1", "10.0.0.2-10.0.0.2", "10.0.0.3-10.0.0.3"}, rangeStrings(chunks))
+	_, err = SplitRangeBalanced(r, 4)
+	require.Error(t, err)
+	_, err = SplitRangeBalanced(r, 0)
+	require.Error(t, err)
+
+	// the whole IPv6 space, whose size doesn't fit in 128 bits
+	chunks, err = SplitPrefixBalanced(netip.MustParsePrefix("::/0"), 3)
+	require.NoError(t, err)
+	require.Len(t, chunks, 3)
+	total := new(big.Int)
+	for i, chunk := range chunks {
+		total.Add(total, chunk.Size())
+		diff := new(big.Int).Sub(chunk.Size(), chunks[len(chunks)-1].Size())
+		require.True(t, diff.Cmp(big.NewInt(1)) <= 0 && diff.Sign() >= 0, i)
+		if i > 0 {
+			require.Equal(t, chunks[i-1].Last.Next(), chunk.First)
+		}
+	}
+	require.Equal(t, new(big.Int).Lsh(big.NewInt(1), 128), total)
+	require.Equal(t, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", chunks[2].Last.String())
+
+	chunks, err = SplitPrefixBalanced(netip.MustParsePrefix("2001:db8::/126"), 4)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2001:db8::-2001:db8::", "2001:db8::1-2001:db8::1", "2001:db8::2-2001:db8::2", "2001:db8::3-2001:db8::3"}, rangeStrings(chunks))
+}
@@ -0,0 +1,341 @@
+package mapcidr
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// IPSet is an immutable set of IPv4 and IPv6 addresses. The zero value is
+// the empty set. Set operations work on address ranges, so they never
+// enumerate the addresses.
+type IPSet struct {
+	// ranges are sorted, IPv4 before IPv6, and neither overlapping nor
+	// adjacent, which makes the representation of a set unique
+	ranges []IPRange
+}
+
+// allAddrs holds the whole IPv4 and IPv6 address spaces.
+var allAddrs = []IPRange{
+	PrefixRange(netip.MustParsePrefix("0.0.0.0/0")),
+	PrefixRange(netip.MustParsePrefix("::/0")),
+}
+
+// IPSetFromPrefixes returns the set of the addresses in the prefixes.
+// Invalid prefixes are ignored, and IPv4-mapped IPv6 prefixes are unmapped.
+func IPSetFromPrefixes(prefixes []netip.Prefix) IPSet {
+	return newIPSet(prefixRanges(prefixes))
+}
+
+// IPSetFromRanges returns the set of the addresses in the ranges. Invalid
+// ranges are ignored, and IPv4-mapped IPv6 ranges are unmapped.
+func IPSetFromRanges(ranges []IPRange) IPSet {
+	return newIPSet(ranges)
+}
+
+// IPSetFromAddrs returns the set of the given addresses. Invalid addresses
+// are ignored, IPv4-mapped IPv6 addresses are unmapped and IPv6 zones are
+// dropped.
+func IPSetFromAddrs(addrs []netip.Addr) IPSet {
+	ranges := make([]IPRange, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = addr.WithZone("")
+		ranges = append(ranges, IPRange{First: addr, Last: addr})
+	}
+	return newIPSet(ranges)
+}
+
+// newIPSet returns the set of the addresses in the ranges, the IPv4-mapped
+// IPv6 addresses being held as IPv4 addresses, as ClassifyAddr classifies
+// them. Ranges only partly made of IPv4-mapped addresses are kept as they
+// are.
+func newIPSet(ranges []IPRange) IPSet {
+	unmapped := make([]IPRange, 0, len(ranges))
+	for _, r := range ranges {
+		unmapped = append(unmapped, unmapRange(r))
+	}
+	return IPSet{ranges: MergeRanges(unmapped)}
+}
+
+// unmapRange returns the range with its IPv4-mapped IPv6 addresses
+// unmapped, if both its ends are IPv4-mapped.
+func unmapRange(r IPRange) IPRange {
+	if r.First.Is4In6() && r.Last.Is4In6() {
+		return IPRange{First: r.First.Unmap(), Last: r.Last.Unmap()}
+	}
+	return r
+}
+
+// IPSetFromIPNets returns the set of the addresses in the networks. Invalid
+// networks are ignored.
+func IPSetFromIPNets(networks []*net.IPNet) IPSet {
+	return IPSetFromPrefixes(prefixesFromIPNets(networks))
+}
+
+// IsEmpty reports whether the set contains no address.
+func (s IPSet) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+// Ranges returns the minimal sorted list of ranges covering the set, IPv4
+// before IPv6.
+func (s IPSet) Ranges() []IPRange {
+	return slices.Clone(s.ranges)
+}
+
+// Prefixes returns the minimal sorted list of prefixes covering the set,
+// IPv4 before IPv6.
+func (s IPSet) Prefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, r := range s.ranges {
+		prefixes = appendRangePrefixes(prefixes, r)
+	}
+	return prefixes
+}
+
+// Count returns the number of addresses in the set.
+func (s IPSet) Count() *big.Int {
+	// sum the range sizes minus one, as the size of ::/0 doesn't fit in 128 bits
+	total := big.NewInt(int64(len(s.ranges)))
+	for _, r := range s.ranges {
+		total.Add(total, u128FromAddr(r.Last).sub(u128FromAddr(r.First)).big())
+	}
+	return total
+}
+
+// Contains reports whether the set contains addr, an IPv4-mapped IPv6
+// address being looked up as an IPv4 address.
+func (s IPSet) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	i := s.search(addr)
+	return i < len(s.ranges) && s.ranges[i].First.Compare(addr) <= 0
+}
+
+// ContainsPrefix reports whether the set contains all the addresses of the
+// prefix, an IPv4-mapped IPv6 prefix being looked up as an IPv4 prefix.
+func (s IPSet) ContainsPrefix(prefix netip.Prefix) bool {
+	if !prefix.IsValid() {
+		return false
+	}
+	r := unmapRange(PrefixRange(prefix))
+	i := s.search(r.First)
+	return i < len(s.ranges) && s.ranges[i].First.Compare(r.First) <= 0 && s.ranges[i].Last.Compare(r.Last) >= 0
+}
+
+// FirstPrefix returns the lowest prefix of length bits entirely in the set,
+// looking at the IPv4 addresses before the IPv6 ones. The second result is
+// false if there is none.
+func (s IPSet) FirstPrefix(bits int) (netip.Prefix, bool) {
+	for _, r := range s.ranges {
+		addrBits := r.First.BitLen()
+		if bits < 0 || bits > addrBits {
+			continue
+		}
+		mask := hostMask(addrBits - bits)
+		first, last := u128FromAddr(r.First), u128FromAddr(r.Last)
+		// the first aligned address of the range
+		if !first.and(mask).isZero() {
+			var overflow bool
+			if first, overflow = first.or(mask).addOverflow(one128); overflow {
+				continue
+			}
+		}
+		if first.or(mask).cmp(last) <= 0 {
+			return netip.PrefixFrom(first.addr(r.First.Is4()), bits), true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// search returns the index of the first range whose last address is not
+// lower than addr.
+func (s IPSet) search(addr netip.Addr) int {
+	return sort.Search(len(s.ranges), func(i int) bool {
+		return s.ranges[i].Last.Compare(addr) >= 0
+	})
+}
+
+// Equal reports whether both sets contain the same addresses.
+func (s IPSet) Equal(o IPSet) bool {
+	return slices.Equal(s.ranges, o.ranges)
+}
+
+// Overlaps reports whether the sets have at least one address in common.
+func (s IPSet) Overlaps(o IPSet) bool {
+	overlaps := false
+	intersectRanges(s.ranges, o.ranges, func(IPRange) bool {
+		overlaps = true
+		return false
+	})
+	return overlaps
+}
+
+// Union returns the set of the addresses in s or o.
+func (s IPSet) Union(o IPSet) IPSet {
+	return IPSet{ranges: MergeRanges(append(slices.Clone(s.ranges), o.ranges...))}
+}
+
+// Intersect returns the set of the addresses both in s and o.
+func (s IPSet) Intersect(o IPSet) IPSet {
+	var ranges []IPRange
+	intersectRanges(s.ranges, o.ranges, func(r IPRange) bool {
+		ranges = append(ranges, r)
+		return true
+	})
+	return IPSet{ranges: ranges}
+}
+
+// Difference returns the set of the addresses in s but not in o.
+func (s IPSet) Difference(o IPSet) IPSet {
+	return IPSet{ranges: subtractRanges(s.ranges, o.ranges)}
+}
+
+// Complement returns the set of the IPv4 and IPv6 addresses not in s.
+func (s IPSet) Complement() IPSet {
+	return IPSet{ranges: subtractRanges(allAddrs, s.ranges)}
+}
+
+// Partition splits the set into n groups with address counts differing by
+// at most one. The groups are consecutive in address order, IPv4 before
+// IPv6, so that each group covers as few ranges as possible.
+func (s IPSet) Partition(n int) ([]IPSet, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of groups %d", n)
+	}
+	weights := make([]int, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return s.PartitionWeighted(weights)
+}
+
+// PartitionWeighted splits the set into one group per weight, with address
+// counts proportional to the weights, e.g. for workers of different
+// capacities. Zero weights get empty groups.
+func (s IPSet) PartitionWeighted(weights []int) ([]IPSet, error) {
+	sizes, err := weightedSizes(s.Count(), weights)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]IPSet, len(sizes))
+	g, left := 0, new(big.Int).Set(sizes[0])
+	for _, r := range s.ranges {
+		for {
+			for left.Sign() == 0 {
+				g++
+				left.Set(sizes[g])
+			}
+			size := r.Size()
+			if size.Cmp(left) <= 0 {
+				groups[g].ranges = append(groups[g].ranges, r)
+				left.Sub(left, size)
+				break
+			}
+			// cut the range at the end of the group
+			take, _ := u128FromBig(new(big.Int).Sub(left, big.NewInt(1)))
+			last := u128FromAddr(r.First).add(take).addr(r.First.Is4())
+			groups[g].ranges = append(groups[g].ranges, IPRange{First: r.First, Last: last})
+			r.First = last.Next()
+			left.SetInt64(0)
+		}
+	}
+	return groups, nil
+}
+
+// weightedSizes splits total proportionally to the weights, using the
+// largest remainders to round the shares, ties going to the first weights.
+func weightedSizes(total *big.Int, weights []int) ([]*big.Int, error) {
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("no weights")
+	}
+	sum := new(big.Int)
+	for _, weight := range weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("invalid weight %d", weight)
+		}
+		sum.Add(sum, big.NewInt(int64(weight)))
+	}
+	if sum.Sign() == 0 {
+		return nil, fmt.Errorf("all the weights are zero")
+	}
+	for _, weight := range weights {
+		if weight > 0 && new(big.Int).Mul(total, big.NewInt(int64(weight))).Cmp(sum) < 0 {
+			return nil, fmt.Errorf("cannot split %s into %d groups with weights %v", total, len(weights), weights)
+		}
+	}
+
+	sizes := make([]*big.Int, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	allocated := new(big.Int)
+	for i, weight := range weights {
+		sizes[i], remainders[i] = new(big.Int).QuoRem(new(big.Int).Mul(total, big.NewInt(int64(weight))), sum, new(big.Int))
+		allocated.Add(allocated, sizes[i])
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]].Cmp(remainders[order[j]]) > 0
+	})
+	for i := 0; allocated.Cmp(total) < 0; i++ {
+		sizes[order[i]].Add(sizes[order[i]], big.NewInt(1))
+		allocated.Add(allocated, big.NewInt(1))
+	}
+	return sizes, nil
+}
+
+// intersectRanges calls yield with the intersections of the ranges of a and
+// b, both sorted and non-overlapping, in order, until yield returns false.
+func intersectRanges(a, b []IPRange, yield func(IPRange) bool) {
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		first, last := a[i].First, a[i].Last
+		if b[j].First.Compare(first) > 0 {
+			first = b[j].First
+		}
+		if b[j].Last.Compare(last) < 0 {
+			last = b[j].Last
+		}
+		// the families are ordered, so ranges of different families never
+		// intersect
+		if first.Compare(last) <= 0 && !yield(IPRange{First: first, Last: last}) {
+			return
+		}
+		if a[i].Last.Compare(b[j].Last) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+}
+
+// subtractRanges returns the parts of the ranges of a not covered by the
+// ranges of b, both sorted and non-overlapping.
+func subtractRanges(a, b []IPRange) []IPRange {
+	var ranges []IPRange
+	j := 0
+	for _, r := range a {
+		// skip the removed ranges lying before r
+		for j < len(b) && b[j].Last.Compare(r.First) < 0 {
+			j++
+		}
+		first, covered := r.First, false
+		for k := j; k < len(b) && b[k].First.Compare(r.Last) <= 0; k++ {
+			if first.Compare(b[k].First) < 0 {
+				ranges = append(ranges, IPRange{First: first, Last: b[k].First.Prev()})
+			}
+			if b[k].Last.Compare(r.Last) >= 0 {
+				covered = true
+				break
+			}
+			first = b[k].Last.Next()
+		}
+		if !covered {
+			ranges = append(ranges, IPRange{First: first, Last: r.Last})
+		}
+	}
+	return ranges
+}
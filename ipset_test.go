@@ -0,0 +1,159 @@
+package mapcidr
+
+import (
+	"math/big"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustIPSet(cidrs ...string) IPSet {
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		prefixes = append(prefixes, netip.MustParsePrefix(cidr))
+	}
+	return IPSetFromPrefixes(prefixes)
+}
+
+func TestIPSetFromPrefixes(t *testing.T) {
+	set := mustIPSet("10.0.0.4/30", "2001:db8::/33", "10.0.0.0/30", "2001:db8:8000::/33", "10.0.0.2/32")
+	require.Equal(t, []string{"10.0.0.0/29", "2001:db8::/32"}, prefixStrings(set.Prefixes()))
+	require.Equal(t, []IPRange{
+		{First: netip.MustParseAddr("10.0.0.0"), Last: netip.MustParseAddr("10.0.0.7")},
+		{First: netip.MustParseAddr("2001:db8::"), Last: netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff")},
+	}, set.Ranges())
+
+	addrs := IPSetFromAddrs([]netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.0"), netip.MustParseAddr("fe80::1%eth0")})
+	require.Equal(t, []string{"10.0.0.0/31", "fe80::1/128"}, prefixStrings(addrs.Prefixes()))
+
+	require.True(t, IPSet{}.IsEmpty())
+	require.Empty(t, IPSet{}.Prefixes())
+}
+
+func TestIPSetOperations(t *testing.T) {
+	a := mustIPSet("10.0.0.0/24", "2001:db8::/64")
+	b := mustIPSet("10.0.0.128/25", "10.0.1.0/24", "2001:db8::/126")
+
+	require.Equal(t, []string{"10.0.0.0/23", "2001:db8::/64"}, prefixStrings(a.Union(b).Prefixes()))
+	require.Equal(t, []string{"10.0.0.128/25", "2001:db8::/126"}, prefixStrings(a.Intersect(b).Prefixes()))
+	require.Equal(t, []string{"10.0.0.0/25", "2001:db8::4/126", "2001:db8::8/125", "2001:db8::10/124"}, prefixStrings(a.Difference(b).Prefixes())[:4])
+	require.Equal(t, []string{"10.0.1.0/24"}, prefixStrings(b.Difference(a).Prefixes()))
+	require.True(t, a.Overlaps(b))
+	require.False(t, mustIPSet("10.0.0.0/24").Overlaps(mustIPSet("10.0.1.0/24", "::/0")))
+
+	// the complement of the complement is the set itself
+	require.True(t, a.Complement().Complement().Equal(a))
+	require.True(t, IPSet{}.Complement().Equal(mustIPSet("0.0.0.0/0", "::/0")))
+	require.True(t, mustIPSet("0.0.0.0/0", "::/0").Complement().IsEmpty())
+	require.Equal(t, []string{"0.0.0.0/1"}, prefixStrings(mustIPSet("128.0.0.0/1", "::/0").Complement().Prefixes()))
+
+	// operations don't modify the operands
+	require.Equal(t, []string{"10.0.0.0/24", "2001:db8::/64"}, prefixStrings(a.Prefixes()))
+}
+
+func TestIPSetContains(t *testing.T) {
+	set := mustIPSet("10.0.0.0/24", "192.168.0.0/16", "2001:db8::/32")
+	require.True(t, set.Contains(netip.MustParseAddr("10.0.0.255")))
+	require.True(t, set.Contains(netip.MustParseAddr("2001:db8::1")))
+	require.False(t, set.Contains(netip.MustParseAddr("10.0.1.0")))
+	require.False(t, set.Contains(netip.MustParseAddr("::1")))
+	require.True(t, set.ContainsPrefix(netip.MustParsePrefix("192.168.10.0/24")))
+	require.False(t, set.ContainsPrefix(netip.MustParsePrefix("10.0.0.0/23")))
+
+	// IPv4-mapped IPv6 addresses are IPv4 addresses, as for ClassifyAddr
+	mapped := netip.MustParseAddr("::ffff:10.0.0.1")
+	require.True(t, mustIPSet("10.0.0.0/8").Contains(mapped))
+	require.Equal(t, CategoryPrivate, ClassifyAddr(mapped).Category)
+	require.True(t, set.ContainsPrefix(netip.MustParsePrefix("::ffff:192.168.10.0/120")))
+	require.Equal(t, []string{"10.0.0.0/8"}, prefixStrings(mustIPSet("::ffff:10.0.0.0/104").Prefixes()))
+	require.Equal(t, []string{"10.0.0.1/32"}, prefixStrings(IPSetFromAddrs([]netip.Addr{mapped}).Prefixes()))
+	require.Equal(t, []string{"10.0.0.0/31"}, prefixStrings(IPSetFromRanges([]IPRange{{First: netip.MustParseAddr("::ffff:10.0.0.0"), Last: mapped}}).Prefixes()))
+}
+
+func TestIPSetFirstPrefix(t *testing.T) {
+	set := mustIPSet("10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.1.0/24", "2001:db8::/64")
+	for _, tt := range []struct {
+		bits     int
+		expected string
+	}{
+		{32, "10.0.0.1/32"},
+		{31, "10.0.0.2/31"},
+		{30, "10.0.0.4/30"},
+		{29, "10.0.1.0/29"},
+		{24, "10.0.1.0/24"},
+		{23, ""},
+		{64, "2001:db8::/64"},
+		{96, "2001:db8::/96"},
+	} {
+		prefix, ok := set.FirstPrefix(tt.bits)
+		require.Equal(t, tt.expected != "", ok, tt.bits)
+		if ok {
+			require.Equal(t, tt.expected, prefix.String())
+		}
+	}
+
+	// whole address spaces
+	prefix, ok := IPSet{}.Complement().FirstPrefix(0)
+	require.True(t, ok)
+	require.Equal(t, "0.0.0.0/0", prefix.String())
+	prefix, ok = mustIPSet("::/0").FirstPrefix(0)
+	require.True(t, ok)
+	require.Equal(t, "::/0", prefix.String())
+	// no aligned block before the end of the address space
+	_, ok = mustIPSet("255.255.255.255/32").FirstPrefix(31)
+	require.False(t, ok)
+}
+
+func TestIPSetCount(t *testing.T) {
+	require.Equal(t, big.NewInt(512), mustIPSet("10.0.0.0/24", "10.0.0.128/25", "192.168.0.0/24").Count())
+	want := new(big.Int).Lsh(big.NewInt(1), 128)
+	want.Add(want, big.NewInt(1<<32))
+	require.Equal(t, want, mustIPSet("0.0.0.0/0", "::/0").Count())
+	require.Zero(t, IPSet{}.Count().Sign())
+}
+
+func TestIPSetPartition(t *testing.T) {
+	set := mustIPSet("10.0.0.0/30", "10.0.1.0/29", "10.0.2.0/31", "2001:db8::/126")
+	groups, err := set.Partition(3)
+	require.NoError(t, err)
+	require.Len(t, groups, 3)
+	union := IPSet{}
+	for _, group := range groups {
+		require.Equal(t, int64(6), group.Count().Int64())
+		require.False(t, union.Overlaps(group))
+		union = union.Union(group)
+	}
+	require.True(t, union.Equal(set))
+	require.Equal(t, []string{"10.0.0.0/30", "10.0.1.0/31"}, prefixStrings(groups[0].Prefixes()))
+	require.Equal(t, []string{"10.0.1.2/31", "10.0.1.4/30"}, prefixStrings(groups[1].Prefixes()))
+	require.Equal(t, []string{"10.0.2.0/31", "2001:db8::/126"}, prefixStrings(groups[2].Prefixes()))
+
+	// counts differ by at most one, the larger groups first
+	groups, err = mustIPSet("10.0.0.0/24").Partition(5)
+	require.NoError(t, err)
+	for i, want := range []int64{52, 51, 51, 51, 51} {
+		require.Equal(t, want, groups[i].Count().Int64())
+	}
+
+	groups, err = mustIPSet("10.0.0.0/24", "::/0").PartitionWeighted([]int{2, 1, 0, 1})
+	require.NoError(t, err)
+	total := new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(256))
+	quarter := new(big.Int).Quo(total, big.NewInt(4))
+	require.Equal(t, new(big.Int).Mul(quarter, big.NewInt(2)), groups[0].Count())
+	require.Equal(t, quarter, groups[1].Count())
+	require.True(t, groups[2].IsEmpty())
+	require.Equal(t, quarter, groups[3].Count())
+	require.Equal(t, "10.0.0.0/24", groups[0].Prefixes()[0].String())
+
+	_, err = set.Partition(0)
+	require.Error(t, err)
+	_, err = set.Partition(19)
+	require.Error(t, err)
+	_, err = set.PartitionWeighted([]int{1, -1})
+	require.Error(t, err)
+	_, err = set.PartitionWeighted([]int{0, 0})
+	require.Error(t, err)
+	_, err = IPSet{}.Partition(1)
+	require.Error(t, err)
+}
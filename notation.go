@@ -0,0 +1,107 @@
+package mapcidr
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Notation is a way of writing an IPv4 prefix.
+type Notation int
+
+const (
+	// NotationCIDR writes the prefix length, e.g. 192.168.1.0/24
+	NotationCIDR Notation = iota
+	// NotationNetmask writes the netmask, e.g. 192.168.1.0 255.255.255.0,
+	// as in interface and route configurations
+	NotationNetmask
+	// NotationWildcard writes the wildcard mask, e.g. 192.168.1.0
+	// 0.0.0.255, as in Cisco ACLs and OSPF network statements
+	NotationWildcard
+)
+
+// ParseNotation parses the name of a notation: cidr, netmask or wildcard.
+func ParseNotation(s string) (Notation, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "cidr":
+		return NotationCIDR, nil
+	case "netmask", "mask":
+		return NotationNetmask, nil
+	case "wildcard":
+		return NotationWildcard, nil
+	}
+	return 0, fmt.Errorf("invalid notation %q: use cidr, netmask or wildcard", s)
+}
+
+// FormatPrefix writes the prefix in the notation. The masks are only for
+// IPv4, IPv6 prefixes are always written in CIDR notation.
+func FormatPrefix(prefix netip.Prefix, notation Notation) string {
+	if !prefix.IsValid() || !prefix.Addr().Is4() {
+		return prefix.String()
+	}
+	switch notation {
+	case NotationNetmask:
+		return fmt.Sprintf("%s %s", prefix.Addr(), prefixNetmask(prefix))
+	case NotationWildcard:
+		return fmt.Sprintf("%s %s", prefix.Addr(), prefixWildcard(prefix))
+	}
+	return prefix.String()
+}
+
+// ParseMaskPrefix parses an IPv4 prefix written with its netmask or its
+// wildcard mask, separated from the address by a slash or spaces, e.g.
+// 192.168.1.0/255.255.255.0, 192.168.1.0 255.255.255.0 or 192.168.1.0
+// 0.0.0.255. The masks must be contiguous. The all-zeros and all-ones
+// masks, which are both a netmask and a wildcard mask, mean the whole
+// address space with the 0.0.0.0 address, as in a default route or an ACL
+// matching any address, and a single address otherwise.
+func ParseMaskPrefix(s string) (netip.Prefix, error) {
+	address, mask, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q: expected an address and a mask", s)
+		}
+		address, mask = fields[0], fields[1]
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil || !addr.Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q: masks are only for IPv4 addresses", s)
+	}
+	maskAddr, err := netip.ParseAddr(strings.TrimSpace(mask))
+	if err != nil || !maskAddr.Is4() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %q: invalid mask %q", s, mask)
+	}
+
+	m := u128FromAddr(maskAddr)
+	switch {
+	case m.isZero() || m == hostMask(ipv4BitLen):
+		if addr.IsUnspecified() {
+			return netip.PrefixFrom(addr, 0), nil
+		}
+		return netip.PrefixFrom(addr, ipv4BitLen), nil
+	case isHostMask(m):
+		// wildcard mask
+		return netip.PrefixFrom(addr, ipv4BitLen-m.bitLen()), nil
+	case isHostMask(m.xor(hostMask(ipv4BitLen))):
+		return netip.PrefixFrom(addr, ipv4BitLen-m.xor(hostMask(ipv4BitLen)).bitLen()), nil
+	}
+	return netip.Prefix{}, fmt.Errorf("invalid prefix %q: %s is not a contiguous netmask or wildcard mask", s, maskAddr)
+}
+
+// isHostMask reports whether u is a mask with only its lowest bits set.
+func isHostMask(u uint128) bool {
+	return u.and(u.addOne()).isZero()
+}
+
+// prefixNetmask returns the netmask of the prefix, e.g. 255.255.255.0 for
+// a /24.
+func prefixNetmask(prefix netip.Prefix) netip.Addr {
+	return hostMask(prefix.Addr().BitLen() - prefix.Bits()).not().addr(prefix.Addr().Is4())
+}
+
+// prefixWildcard returns the wildcard mask of the prefix, the complement of
+// its netmask, e.g. 0.0.0.255 for a /24.
+func prefixWildcard(prefix netip.Prefix) netip.Addr {
+	return hostMask(prefix.Addr().BitLen() - prefix.Bits()).addr(prefix.Addr().Is4())
+}
@@ -0,0 +1,68 @@
+package mapcidr
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaskPrefix(t *testing.T) {
+	for _, tt := range []struct{ input, expected string }{
+		{"192.168.1.0 255.255.255.0", "192.168.1.0/24"},
+		{"192.168.1.0/255.255.255.0", "192.168.1.0/24"},
+		{"192.168.1.0  255.255.254.0", "192.168.1.0/23"},
+		{"10.0.0.0 0.0.255.255", "10.0.0.0/16"},
+		{"10.0.0.0/0.255.255.255", "10.0.0.0/8"},
+		{"10.0.0.1 0.0.0.0", "10.0.0.1/32"},
+		{"10.0.0.1 255.255.255.255", "10.0.0.1/32"},
+		{"0.0.0.0 0.0.0.0", "0.0.0.0/0"},
+		{"0.0.0.0 255.255.255.255", "0.0.0.0/0"},
+		{"10.0.0.0 255.255.255.254", "10.0.0.0/31"},
+		{"10.0.0.0 0.0.0.1", "10.0.0.0/31"},
+	} {
+		prefix, err := ParseMaskPrefix(tt.input)
+		require.NoError(t, err, tt.input)
+		require.Equal(t, tt.expected, prefix.String(), tt.input)
+	}
+
+	for _, input := range []string{"192.168.1.0 255.0.255.0", "192.168.1.0 0.255.0.255", "192.168.1.0/24", "192.168.1.0", "2001:db8:: ffff:ffff::", "10.0.0.0 255.255.255.0 1", "foo 255.0.0.0"} {
+		_, err := ParseMaskPrefix(input)
+		require.Error(t, err, input)
+	}
+	_, err := ParseMaskPrefix("192.168.1.0 255.0.255.0")
+	require.EqualError(t, err, `invalid prefix "192.168.1.0 255.0.255.0": 255.0.255.0 is not a contiguous netmask or wildcard mask`)
+}
+
+func TestFormatPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		cidr                     string
+		cidrs, netmask, wildcard string
+	}{
+		{"192.168.1.0/24", "192.168.1.0/24", "192.168.1.0 255.255.255.0", "192.168.1.0 0.0.0.255"},
+		{"10.0.0.0/9", "10.0.0.0/9", "10.0.0.0 255.128.0.0", "10.0.0.0 0.127.255.255"},
+		{"10.0.0.1/32", "10.0.0.1/32", "10.0.0.1 255.255.255.255", "10.0.0.1 0.0.0.0"},
+		{"0.0.0.0/0", "0.0.0.0/0", "0.0.0.0 0.0.0.0", "0.0.0.0 255.255.255.255"},
+		{"2001:db8::/32", "2001:db8::/32", "2001:db8::/32", "2001:db8::/32"},
+	} {
+		prefix := netip.MustParsePrefix(tt.cidr)
+		require.Equal(t, tt.cidrs, FormatPrefix(prefix, NotationCIDR))
+		require.Equal(t, tt.netmask, FormatPrefix(prefix, NotationNetmask))
+		require.Equal(t, tt.wildcard, FormatPrefix(prefix, NotationWildcard))
+
+		// the formatted prefixes are parsed back
+		if prefix.Addr().Is4() {
+			for _, notation := range []Notation{NotationNetmask, NotationWildcard} {
+				parsed, err := ParseMaskPrefix(FormatPrefix(prefix, notation))
+				require.NoError(t, err)
+				require.Equal(t, prefix, parsed)
+			}
+		}
+	}
+
+	notation, err := ParseNotation("Wildcard")
+	require.NoError(t, err)
+	require.Equal(t, NotationWildcard, notation)
+	_, err = ParseNotation("binary")
+	require.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package mapcidr
+
+import (
+	"math"
+
+	"github.com/projectdiscovery/blackrock"
+)
+
+// permutation maps every index of [0, size) to a distinct index of the same
+// interval.
+type permutation interface {
+	shuffle(index uint128) uint128
+}
+
+// newPermutation returns a seeded permutation of [0, size). Sizes fitting in
+// an int64 use blackrock, so that a seed keeps giving the orders of the
+// earlier blackrock based shuffling for the same targets, and for the same
+// ports in the same order (see shufflePrefixesWithPorts); larger ones use a
+// Feistel network.
+func newPermutation(size uint128, seed int64) permutation {
+	if size.hi == 0 && size.lo <= math.MaxInt64 {
+		return blackrockPermutation{blackrock.New(int64(size.lo), seed)}
+	}
+	return newFeistelPermutation(size, seed)
+}
+
+type blackrockPermutation struct {
+	br *blackrock.BlackRock
+}
+
+func (p blackrockPermutation) shuffle(index uint128) uint128 {
+	return uint128{0, uint64(p.br.Shuffle(int64(index.lo)))}
+}
+
+const feistelRounds = 4
+
+// feistelPermutation is a balanced Feistel network over the smallest even
+// number of bits covering size. Values falling outside [0, size) are
+// encrypted again (cycle walking) until they come back inside, which
+// keeps the mapping bijective.
+type feistelPermutation struct {
+	size     uint128
+	halfBits uint
+	keys     [feistelRounds]uint64
+}
+
+func newFeistelPermutation(size uint128, seed int64) *feistelPermutation {
+	bits := size.subOne().bitLen()
+	bits += bits % 2
+	if bits < 2 {
+		bits = 2
+	}
+	p := &feistelPermutation{size: size, halfBits: uint(bits / 2)}
+	state := uint64(seed)
+	for i := range p.keys {
+		state += 0x9e3779b97f4a7c15
+		p.keys[i] = mix64(state)
+	}
+	return p
+}
+
+func (p *feistelPermutation) shuffle(index uint128) uint128 {
+	for {
+		index = p.encrypt(index)
+		if index.cmp(p.size) < 0 {
+			return index
+		}
+	}
+}
+
+func (p *feistelPermutation) encrypt(v uint128) uint128 {
+	mask := hostMask(int(p.halfBits)).lo
+	left, right := v.rsh(p.halfBits).lo, v.lo&mask
+	for _, key := range p.keys {
+		left, right = right, left^(mix64(right^key)&mask)
+	}
+	return uint128{0, left}.lsh(p.halfBits).or(uint128{0, right})
+}
+
+// mix64 is the splitmix64 finalizer, used as the round function.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,246 @@
+package mapcidr
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortSet is an immutable set of TCP/UDP ports, from 1 to 65535. It is
+// stored as ranges, so that large sets such as all the ports don't
+// materialize a slice. The zero value is the empty set.
+type PortSet struct {
+	// ranges are sorted, and neither overlapping nor adjacent
+	ranges []portRange
+	// offsets holds the index in the set of the first port of each range
+	offsets []int
+	len     int
+}
+
+type portRange struct {
+	first, last int
+}
+
+// ParsePorts parses a comma separated port specification. Each item is
+// either:
+//   - a port, e.g. "443"
+//   - a range, e.g. "1-1024"; "-1024" starts from 1, "8000-" ends at 65535
+//     and "-" means all the ports
+//   - a service name from the bundled services table, e.g. "https"
+//   - a preset of the most common ports: "top-100" or "top-1000"
+//
+// Items prefixed with "!" are removed from the set, e.g. "1-1024,!22"; a
+// specification made only of exclusions removes them from all the ports.
+func ParsePorts(spec string) (PortSet, error) {
+	var included, excluded []portRange
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		exclude := strings.HasPrefix(item, "!")
+		if exclude {
+			item = strings.TrimSpace(item[1:])
+		}
+		ranges, err := parsePortItem(item)
+		if err != nil {
+			return PortSet{}, err
+		}
+		if exclude {
+			excluded = append(excluded, ranges...)
+		} else {
+			included = append(included, ranges...)
+		}
+	}
+	if len(included) == 0 {
+		if len(excluded) == 0 {
+			return PortSet{}, fmt.Errorf("invalid port specification %q: no port", spec)
+		}
+		included = []portRange{{first: 1, last: 65535}}
+	}
+	ranges := subtractPortRanges(mergePortRanges(included), mergePortRanges(excluded))
+	if len(ranges) == 0 {
+		return PortSet{}, fmt.Errorf("invalid port specification %q: all the ports are excluded", spec)
+	}
+	return newPortSet(ranges), nil
+}
+
+// parsePortItem parses a single item of a port specification, without its
+// exclusion mark.
+func parsePortItem(item string) ([]portRange, error) {
+	if item == "" {
+		return nil, fmt.Errorf("invalid port specification: empty item")
+	}
+	if ranges, ok := topPorts[strings.ToLower(item)]; ok {
+		return ranges, nil
+	}
+	if port, ok := servicePorts[strings.ToLower(item)]; ok {
+		return []portRange{{first: port, last: port}}, nil
+	}
+	r, err := parsePortRange(item)
+	if err != nil {
+		return nil, err
+	}
+	return []portRange{r}, nil
+}
+
+// parsePortRange parses a port or a port range.
+func parsePortRange(item string) (portRange, error) {
+	first, last, isRange := strings.Cut(item, "-")
+	if !isRange {
+		last = first
+	}
+	var (
+		r   = portRange{first: 1, last: 65535}
+		err error
+	)
+	if first != "" {
+		if r.first, err = parsePort(first); err != nil {
+			return portRange{}, err
+		}
+	}
+	if last != "" {
+		if r.last, err = parsePort(last); err != nil {
+			return portRange{}, err
+		}
+	}
+	if r.first > r.last {
+		return portRange{}, fmt.Errorf("invalid port range %q: %d is greater than %d", item, r.first, r.last)
+	}
+	return r, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q: unknown service or not a number", s)
+	}
+	if port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %d", port)
+	}
+	return port, nil
+}
+
+// PortSetFromPorts returns the set of the given ports, duplicates being
+// ignored.
+func PortSetFromPorts(ports []int) (PortSet, error) {
+	ranges := make([]portRange, 0, len(ports))
+	for _, port := range ports {
+		if port <= 0 || port > 65535 {
+			return PortSet{}, fmt.Errorf("invalid port %d", port)
+		}
+		ranges = append(ranges, portRange{first: port, last: port})
+	}
+	return newPortSet(mergePortRanges(ranges)), nil
+}
+
+// newPortSet returns the set of the sorted and merged ranges.
+func newPortSet(ranges []portRange) PortSet {
+	s := PortSet{ranges: ranges, offsets: make([]int, len(ranges))}
+	for i, r := range ranges {
+		s.offsets[i] = s.len
+		s.len += r.last - r.first + 1
+	}
+	return s
+}
+
+// mergePortRanges sorts the ranges and merges the overlapping and adjacent
+// ones.
+func mergePortRanges(ranges []portRange) []portRange {
+	ranges = slices.Clone(ranges)
+	slices.SortFunc(ranges, func(a, b portRange) int {
+		return a.first - b.first
+	})
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.first <= merged[n-1].last+1 {
+			merged[n-1].last = max(merged[n-1].last, r.last)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// subtractPortRanges returns the parts of the ranges of a not covered by the
+// ranges of b, both sorted and merged.
+func subtractPortRanges(a, b []portRange) []portRange {
+	var ranges []portRange
+	j := 0
+	for _, r := range a {
+		for j < len(b) && b[j].last < r.first {
+			j++
+		}
+		first, covered := r.first, false
+		for k := j; k < len(b) && b[k].first <= r.last; k++ {
+			if first < b[k].first {
+				ranges = append(ranges, portRange{first: first, last: b[k].first - 1})
+			}
+			if b[k].last >= r.last {
+				covered = true
+				break
+			}
+			first = b[k].last + 1
+		}
+		if !covered {
+			ranges = append(ranges, portRange{first: first, last: r.last})
+		}
+	}
+	return ranges
+}
+
+// union returns the set of the ports in s or o.
+func (s PortSet) union(o PortSet) PortSet {
+	return newPortSet(mergePortRanges(append(slices.Clone(s.ranges), o.ranges...)))
+}
+
+// Len returns the number of ports in the set.
+func (s PortSet) Len() int {
+	return s.len
+}
+
+// At returns the i-th port of the set in ascending order. It panics if i is
+// out of range.
+func (s PortSet) At(i int) int {
+	if i < 0 || i >= s.len {
+		panic(fmt.Sprintf("port index %d out of range [0, %d)", i, s.len))
+	}
+	k := sort.Search(len(s.offsets), func(k int) bool {
+		return s.offsets[k] > i
+	}) - 1
+	return s.ranges[k].first + i - s.offsets[k]
+}
+
+// Contains reports whether the set contains the port.
+func (s PortSet) Contains(port int) bool {
+	k := sort.Search(len(s.ranges), func(k int) bool {
+		return s.ranges[k].last >= port
+	})
+	return k < len(s.ranges) && s.ranges[k].first <= port
+}
+
+// All returns an iterator over the ports of the set in ascending order.
+func (s PortSet) All() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for _, r := range s.ranges {
+			for port := r.first; port <= r.last; port++ {
+				if !yield(port) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// String returns the shortest specification of the set, e.g. "22,80-90".
+func (s PortSet) String() string {
+	items := make([]string, 0, len(s.ranges))
+	for _, r := range s.ranges {
+		if r.first == r.last {
+			items = append(items, strconv.Itoa(r.first))
+		} else {
+			items = append(items, strconv.Itoa(r.first)+"-"+strconv.Itoa(r.last))
+		}
+	}
+	return strings.Join(items, ",")
+}
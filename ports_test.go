@@ -0,0 +1,94 @@
+package mapcidr
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustParsePorts(t *testing.T, spec string) PortSet {
+	t.Helper()
+	ports, err := ParsePorts(spec)
+	require.NoError(t, err)
+	return ports
+}
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+		len  int
+	}{
+		{spec: "443", want: "443", len: 1},
+		{spec: "443,80,443", want: "80,443", len: 2},
+		{spec: "1-1024", want: "1-1024", len: 1024},
+		{spec: "1-1024,!22", want: "1-21,23-1024", len: 1023},
+		{spec: "!22, !80-90", want: "1-21,23-79,91-65535", len: 65535 - 12},
+		{spec: "-1024", want: "1-1024", len: 1024},
+		{spec: "65000-", want: "65000-65535", len: 536},
+		{spec: "-", want: "1-65535", len: 65535},
+		{spec: "HTTP,https,ssh", want: "22,80,443", len: 3},
+		{spec: "8000-8100,8080", want: "8000-8100", len: 101},
+		{spec: "8000-8001,8002", want: "8000-8002", len: 3},
+		{spec: "top-100", len: 100},
+		{spec: "top-1000", len: 1000},
+		{spec: "top-1000,!https", len: 999},
+	}
+	for _, tt := range tests {
+		ports, err := ParsePorts(tt.spec)
+		require.NoError(t, err, tt.spec)
+		require.Equal(t, tt.len, ports.Len(), tt.spec)
+		if tt.want != "" {
+			require.Equal(t, tt.want, ports.String(), tt.spec)
+		}
+	}
+
+	for _, spec := range []string{"", "0", "65536", "80,", "443-80", "unknown", "1-2-3", "!-"} {
+		_, err := ParsePorts(spec)
+		require.Error(t, err, spec)
+	}
+}
+
+func TestPortSet(t *testing.T) {
+	ports := mustParsePorts(t, "22,80-82,!81,443,8000-8002")
+	all := slices.Collect(ports.All())
+	require.Equal(t, []int{22, 80, 82, 443, 8000, 8001, 8002}, all)
+	for i, port := range all {
+		require.Equal(t, port, ports.At(i))
+		require.True(t, ports.Contains(port))
+	}
+	for _, port := range []int{0, 21, 81, 444, 8003, 65535} {
+		require.False(t, ports.Contains(port))
+	}
+	require.Panics(t, func() { ports.At(len(all)) })
+
+	top := mustParsePorts(t, "top-100")
+	require.True(t, top.Contains(443))
+	require.True(t, mustParsePorts(t, "top-1000").Contains(8443))
+
+	fromPorts, err := PortSetFromPorts([]int{443, 80, 443})
+	require.NoError(t, err)
+	require.Equal(t, "80,443", fromPorts.String())
+	_, err = PortSetFromPorts([]int{0})
+	require.Error(t, err)
+	_, err = PortSetFromPorts([]int{65536})
+	require.Error(t, err)
+}
+
+func TestShufflerAllPorts(t *testing.T) {
+	// the port space is never expanded, a /16 with every port stays cheap
+	s, err := NewShuffler([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/16")}, mustParsePorts(t, "-"), ShuffleOptions{Seed: 1})
+	require.NoError(t, err)
+	require.Equal(t, "4294901760", s.Total().String())
+	seen := make(map[netip.AddrPort]struct{})
+	for target := range s.All() {
+		require.True(t, target.Port() >= 1)
+		seen[target] = struct{}{}
+		if len(seen) == 1000 {
+			break
+		}
+	}
+	require.Len(t, seen, 1000)
+}
@@ -0,0 +1,453 @@
+package mapcidr
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// AddrFromIP converts a net.IP to a netip.Addr. IPv4-mapped IPv6 addresses
+// are returned as IPv4, consistently with net.IP.To4.
+func AddrFromIP(ip net.IP) (netip.Addr, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// PrefixFromIPNet converts a net.IPNet to a masked netip.Prefix.
+func PrefixFromIPNet(network *net.IPNet) (netip.Prefix, bool) {
+	if network == nil {
+		return netip.Prefix{}, false
+	}
+	addr, ok := AddrFromIP(network.IP)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	ones, size := network.Mask.Size()
+	switch {
+	case size == 0:
+		return netip.Prefix{}, false
+	case addr.Is4() && size == ipv6BitLen:
+		// IPv4 address with an IPv4-mapped IPv6 mask
+		ones -= ipv6BitLen - ipv4BitLen
+	case addr.Is6() && size == ipv4BitLen:
+		return netip.Prefix{}, false
+	}
+	prefix, err := addr.Prefix(ones)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
+
+// IPNetFromPrefix converts a netip.Prefix to a net.IPNet.
+func IPNetFromPrefix(prefix netip.Prefix) *net.IPNet {
+	prefix = prefix.Masked()
+	return &net.IPNet{
+		IP:   prefix.Addr().AsSlice(),
+		Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+	}
+}
+
+// PrefixesFromIPNets converts a list of net.IPNet to netip.Prefix.
+func PrefixesFromIPNets(networks []*net.IPNet) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		prefix, ok := PrefixFromIPNet(network)
+		if !ok {
+			return nil, fmt.Errorf("invalid network %s", network)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// IPNetsFromPrefixes converts a list of netip.Prefix to net.IPNet.
+func IPNetsFromPrefixes(prefixes []netip.Prefix) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		networks = append(networks, IPNetFromPrefix(prefix))
+	}
+	return networks
+}
+
+// PrefixRange returns the range of addresses covered by the prefix.
+func PrefixRange(prefix netip.Prefix) IPRange {
+	first, last := prefixRange(prefix)
+	is4 := prefix.Addr().Is4()
+	return IPRange{First: first.addr(is4), Last: last.addr(is4)}
+}
+
+// PrefixHostRange returns the range of the prefix without its network
+// address, the first one, and its broadcast address, the last one, as asked.
+// IPv6 prefixes are handled the same way, skipping their subnet-router
+// anycast and last addresses. Following RFC 3021, prefixes of at most two
+// addresses, such as /31 and /32, are point-to-point links without network
+// and broadcast addresses, and are returned whole.
+func PrefixHostRange(prefix netip.Prefix, skipNetwork, skipBroadcast bool) IPRange {
+	r := PrefixRange(prefix)
+	if !prefix.IsValid() || prefix.Addr().BitLen()-prefix.Bits() <= 1 {
+		return r
+	}
+	if skipNetwork {
+		r.First = r.First.Next()
+	}
+	if skipBroadcast {
+		r.Last = r.Last.Prev()
+	}
+	return r
+}
+
+// PrefixAddressCount returns the exact number of addresses in the prefix.
+func PrefixAddressCount(prefix netip.Prefix) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(prefix.Addr().BitLen()-prefix.Bits()))
+}
+
+// SplitPrefixIntoN attempts to split a prefix in the exact number of subnets.
+// The prefix is first split into the largest power of two less than or
+// equal to n, then the last subnet is halved until n subnets are reached.
+func SplitPrefixIntoN(prefix netip.Prefix, n int) ([]netip.Prefix, error) {
+	subnets, err := splitPrefixSeq(prefix, big.NewInt(int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	return slices.Collect(subnets), nil
+}
+
+// SplitPrefixBalanced splits a prefix into n contiguous chunks whose address
+// counts differ by at most one, unlike SplitPrefixIntoN which keeps aligned
+// subnets. Use IPRange.Prefixes to get the minimal prefixes of each chunk.
+func SplitPrefixBalanced(prefix netip.Prefix, n int) ([]IPRange, error) {
+	if !prefix.IsValid() {
+		return nil, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	return SplitRangeBalanced(PrefixRange(prefix), n)
+}
+
+// SplitPrefixByRatio splits a prefix into one part per weight, with address
+// counts proportional to the weights, e.g. 3:1 or 50:25:25. Each part is the
+// minimal list of aligned subnets covering it. The shares are rounded to
+// subnets of maxBits prefix length, or to single addresses if maxBits is
+// zero, and it fails if a part with a positive weight gets nothing.
+func SplitPrefixByRatio(prefix netip.Prefix, weights []int, maxBits int) ([][]netip.Prefix, error) {
+	if !prefix.IsValid() {
+		return nil, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	prefix = prefix.Masked()
+	familyBits := prefix.Addr().BitLen()
+	if maxBits == 0 {
+		maxBits = familyBits
+	}
+	if maxBits < prefix.Bits() || maxBits > familyBits {
+		return nil, fmt.Errorf("cannot split %s into /%d subnets", prefix, maxBits)
+	}
+	units := new(big.Int).Lsh(big.NewInt(1), uint(maxBits-prefix.Bits()))
+	sizes, err := weightedSizes(units, weights)
+	if err != nil {
+		return nil, fmt.Errorf("cannot split %s by %v with subnets of at most /%d: %w", prefix, weights, maxBits, err)
+	}
+
+	// larger parts first keep the subnets aligned, and so fewer
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]].Cmp(sizes[order[j]]) > 0
+	})
+	is4 := prefix.Addr().Is4()
+	unitBits := uint(familyBits - maxBits)
+	cur, _ := prefixRange(prefix)
+	parts := make([][]netip.Prefix, len(sizes))
+	for _, i := range order {
+		if sizes[i].Sign() == 0 {
+			continue
+		}
+		// the part size minus one, as a part may be the whole ::/0
+		span := new(big.Int).Lsh(sizes[i], unitBits)
+		offset, _ := u128FromBig(span.Sub(span, big.NewInt(1)))
+		last := cur.add(offset)
+		parts[i] = appendRangePrefixes(nil, IPRange{First: cur.addr(is4), Last: last.addr(is4)})
+		cur = last.addOne()
+	}
+	return parts, nil
+}
+
+// SplitPrefixByNumber splits a prefix into subnets with the closest number
+// of hosts per subnet.
+func SplitPrefixByNumber(prefix netip.Prefix, number int) ([]netip.Prefix, error) {
+	n, err := splitByNumberCount(prefix, number)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsInt64() || n.Int64() > math.MaxInt32 {
+		return nil, fmt.Errorf("splitting %s by %d hosts yields %s subnets, use SplitPrefixByNumberSeq", prefix, number, n)
+	}
+	subnets, err := splitPrefixSeq(prefix, n)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Collect(subnets), nil
+}
+
+// SplitPrefixByNumberSeq is like SplitPrefixByNumber but lazily yields the
+// subnets, which allows splitting large IPv6 prefixes into a number of
+// subnets that wouldn't fit in memory.
+func SplitPrefixByNumberSeq(prefix netip.Prefix, number int) (iter.Seq[netip.Prefix], error) {
+	n, err := splitByNumberCount(prefix, number)
+	if err != nil {
+		return nil, err
+	}
+	return splitPrefixSeq(prefix, n)
+}
+
+// SplitPrefixByLength splits a prefix into all its subnets of the given
+// prefix length, e.g. a /16 into 256 /24s.
+func SplitPrefixByLength(prefix netip.Prefix, bits int) ([]netip.Prefix, error) {
+	n, err := SplitPrefixByLengthCount(prefix, bits)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsInt64() || n.Int64() > math.MaxInt32 {
+		return nil, fmt.Errorf("splitting %s into /%d yields %s subnets, use SplitPrefixByLengthSeq", prefix, bits, n)
+	}
+	subnets, err := SplitPrefixByLengthSeq(prefix, bits)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Collect(subnets), nil
+}
+
+// SplitPrefixByLengthSeq is like SplitPrefixByLength but lazily yields the
+// subnets, so that splitting e.g. an IPv6 /32 into /64s allocates nothing
+// up front.
+func SplitPrefixByLengthSeq(prefix netip.Prefix, bits int) (iter.Seq[netip.Prefix], error) {
+	if _, err := SplitPrefixByLengthCount(prefix, bits); err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+	return func(yield func(netip.Prefix) bool) {
+		if bits == prefix.Bits() {
+			yield(prefix)
+			return
+		}
+		is4 := prefix.Addr().Is4()
+		first, last := prefixRange(prefix)
+		step := one128.lsh(uint(prefix.Addr().BitLen() - bits))
+		for cur := first; ; cur = cur.add(step) {
+			if !yield(netip.PrefixFrom(cur.addr(is4), bits)) {
+				return
+			}
+			// stop before wrapping around the end of the address space
+			if last.sub(cur).cmp(step) < 0 {
+				return
+			}
+		}
+	}, nil
+}
+
+// SplitPrefixByLengthCount returns the number of subnets of the given prefix
+// length in the prefix, e.g. to check the size of a split before running it.
+func SplitPrefixByLengthCount(prefix netip.Prefix, bits int) (*big.Int, error) {
+	if !prefix.IsValid() {
+		return nil, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	if bits < prefix.Bits() || bits > prefix.Addr().BitLen() {
+		return nil, fmt.Errorf("cannot split %s into /%d subnets", prefix, bits)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-prefix.Bits())), nil
+}
+
+// splitByNumberCount returns the number of subnets of number hosts fitting in
+// the prefix.
+func splitByNumberCount(prefix netip.Prefix, number int) (*big.Int, error) {
+	if number <= 0 {
+		return nil, fmt.Errorf("invalid number of hosts %d", number)
+	}
+	// truncate result to nearest integer
+	return new(big.Int).Quo(PrefixAddressCount(prefix), big.NewInt(int64(number))), nil
+}
+
+// splitPrefixSeq returns the sequence of subnets splitting prefix in n parts.
+// The whole layout is validated before anything is yielded.
+func splitPrefixSeq(prefix netip.Prefix, n *big.Int) (iter.Seq[netip.Prefix], error) {
+	prefix = prefix.Masked()
+	familyBits := prefix.Addr().BitLen()
+	availableBits := familyBits - prefix.Bits()
+
+	// invalid value or impossible split
+	if n.Cmp(big.NewInt(1)) <= 0 || availableBits < new(big.Int).Sub(n, big.NewInt(1)).BitLen() {
+		return func(yield func(netip.Prefix) bool) {
+			yield(prefix)
+		}, nil
+	}
+
+	powerBits := n.BitLen() - 1
+	remainderBig := new(big.Int).Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(powerBits)))
+	if !remainderBig.IsInt64() || int64(powerBits)+remainderBig.Int64() > int64(availableBits) {
+		last := netip.PrefixFrom(prefix.Addr(), familyBits)
+		return nil, fmt.Errorf("cannot divide subnet %s further to reach %s splits", last, n)
+	}
+	remainder := int(remainderBig.Int64())
+
+	return func(yield func(netip.Prefix) bool) {
+		is4 := prefix.Addr().Is4()
+		cur := u128FromAddr(prefix.Addr())
+		subnetBits := prefix.Bits() + powerBits
+		step := one128.lsh(uint(familyBits - subnetBits))
+		// index of the last subnet of the power of two split, unless it
+		// gets divided further
+		lastIndex := hostMask(powerBits)
+		if remainder > 0 {
+			lastIndex = lastIndex.subOne()
+		}
+		for i := zero128; ; i = i.addOne() {
+			if !yield(netip.PrefixFrom(cur.addr(is4), subnetBits)) {
+				return
+			}
+			cur = cur.add(step)
+			if i == lastIndex {
+				break
+			}
+		}
+		// halve the last subnet until n subnets are reached
+		for i := 1; i <= remainder; i++ {
+			if !yield(netip.PrefixFrom(cur.addr(is4), subnetBits+i)) {
+				return
+			}
+			cur = cur.add(one128.lsh(uint(familyBits - subnetBits - i)))
+		}
+		if remainder > 0 {
+			yield(netip.PrefixFrom(cur.addr(is4), subnetBits+remainder))
+		}
+	}, nil
+}
+
+// PrefixesFromRange returns the sorted minimal list of prefixes covering
+// all the addresses between first and last, both included.
+func PrefixesFromRange(first, last netip.Addr) ([]netip.Prefix, error) {
+	r := IPRange{First: first.Unmap(), Last: last.Unmap()}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r.Prefixes(), nil
+}
+
+// CoalescePrefixes transforms the provided list of prefixes into the
+// most-minimal equivalent sorted set of IPv4 and IPv6 prefixes.
+func CoalescePrefixes(prefixes []netip.Prefix) (coalescedIPV4, coalescedIPV6 []netip.Prefix) {
+	ranges := make([]IPRange, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix.IsValid() {
+			ranges = append(ranges, PrefixRange(prefix))
+		}
+	}
+	for _, r := range MergeRanges(ranges) {
+		if r.First.Is4() {
+			coalescedIPV4 = appendRangePrefixes(coalescedIPV4, r)
+		} else {
+			coalescedIPV6 = appendRangePrefixes(coalescedIPV6, r)
+		}
+	}
+	return
+}
+
+// RemovePrefixes removes the specified prefixes from another set of prefixes
+// and returns the minimal sorted list of the prefixes left, IPv4 before
+// IPv6. Both lists may mix IPv4 and IPv6 prefixes, each family being
+// subtracted separately. The input slices are not modified.
+func RemovePrefixes(allowPrefixes, removePrefixes []netip.Prefix) ([]netip.Prefix, error) {
+	for _, prefix := range slices.Concat(allowPrefixes, removePrefixes) {
+		if !prefix.IsValid() {
+			return nil, fmt.Errorf("invalid prefix %s", prefix)
+		}
+	}
+	// both sets are sorted ranges, subtracted in a single sweep
+	allow := IPSetFromPrefixes(allowPrefixes)
+	return allow.Difference(IPSetFromPrefixes(removePrefixes)).Prefixes(), nil
+}
+
+// FreeSpace returns the addresses of the pools not covered by the used
+// prefixes. Both lists may mix IPv4 and IPv6 prefixes; the gaps are given by
+// the Prefixes or Ranges of the set.
+func FreeSpace(pools, used []netip.Prefix) IPSet {
+	return IPSetFromPrefixes(pools).Difference(IPSetFromPrefixes(used))
+}
+
+// NextFreePrefix returns the lowest prefix of length bits in the pools not
+// overlapping the used prefixes, IPv4 pools being looked at first.
+func NextFreePrefix(pools, used []netip.Prefix, bits int) (netip.Prefix, error) {
+	prefix, ok := FreeSpace(pools, used).FirstPrefix(bits)
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("no free /%d left", bits)
+	}
+	return prefix, nil
+}
+
+// PrefixAddrsSeq returns an iterator over all the addresses in the prefix.
+func PrefixAddrsSeq(prefix netip.Prefix) iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		if !prefix.IsValid() {
+			return
+		}
+		r := PrefixRange(prefix)
+		for addr := r.First; ; addr = addr.Next() {
+			if !yield(addr) || addr == r.Last {
+				return
+			}
+		}
+	}
+}
+
+// ShufflePrefixesWithSeed visits all the IPv4 and IPv6 addresses in the
+// given prefixes in random order. The same seed always yields the same order.
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use ShufflePrefixesSeq instead.
+func ShufflePrefixesWithSeed(prefixes []netip.Prefix, seed int64) chan netip.Addr {
+	return seqToChan(ShufflePrefixesSeq(prefixes, seed))
+}
+
+// ShufflePrefixesWithPortsAndSeed visits all the IPv4 and IPv6 addresses and
+// ports combinations in random order.
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use ShufflePrefixesWithPortsSeq instead.
+func ShufflePrefixesWithPortsAndSeed(prefixes []netip.Prefix, ports []int, seed int64) chan netip.AddrPort {
+	return seqToChan(ShufflePrefixesWithPortsSeq(prefixes, ports, seed))
+}
+
+// ShufflePrefixesSeq returns an iterator visiting all the IPv4 and IPv6
+// addresses in the given prefixes in random order. The same seed always
+// yields the same order.
+func ShufflePrefixesSeq(prefixes []netip.Prefix, seed int64) iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		shufflePrefixes(prefixes, seed, yield)
+	}
+}
+
+// ShufflePrefixesWithPortsSeq returns an iterator visiting all the IPv4 and
+// IPv6 addresses and ports combinations in random order.
+func ShufflePrefixesWithPortsSeq(prefixes []netip.Prefix, ports []int, seed int64) iter.Seq[netip.AddrPort] {
+	return func(yield func(netip.AddrPort) bool) {
+		shufflePrefixesWithPorts(prefixes, ports, seed, yield)
+	}
+}
+
+// prefixRanges returns the address ranges of the prefixes.
+func prefixRanges(prefixes []netip.Prefix) []IPRange {
+	ranges := make([]IPRange, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix.IsValid() {
+			ranges = append(ranges, PrefixRange(prefix))
+		}
+	}
+	return ranges
+}
@@ -0,0 +1,316 @@
+package mapcidr
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	var s []string
+	for _, prefix := range prefixes {
+		s = append(s, prefix.String())
+	}
+	return s
+}
+
+func ipnetStrings(networks []*net.IPNet) []string {
+	var s []string
+	for _, network := range networks {
+		s = append(s, network.String())
+	}
+	return s
+}
+
+func TestPrefixFromIPNet(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.1.0/24")
+	prefix, ok := PrefixFromIPNet(ipnet)
+	require.True(t, ok)
+	require.Equal(t, "192.168.1.0/24", prefix.String())
+	require.Equal(t, ipnet.String(), IPNetFromPrefix(prefix).String())
+
+	// IPv4 address with a 128 bits mask
+	mapped := &net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(104, 128)}
+	prefix, ok = PrefixFromIPNet(mapped)
+	require.True(t, ok)
+	require.Equal(t, "10.0.0.0/8", prefix.String())
+
+	_, ok = PrefixFromIPNet(&net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(8, 32)})
+	require.False(t, ok)
+}
+
+func TestAddressRangePrefix(t *testing.T) {
+	for _, tt := range []struct{ cidr, first, last string }{
+		{"192.168.0.0/24", "192.168.0.0", "192.168.0.255"},
+		{"10.0.0.1/32", "10.0.0.1", "10.0.0.1"},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255"},
+		{"2001:db8::/64", "2001:db8::", "2001:db8::ffff:ffff:ffff:ffff"},
+		{"::/0", "::", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+	} {
+		r := PrefixRange(netip.MustParsePrefix(tt.cidr))
+		require.Equal(t, tt.first, r.First.String())
+		require.Equal(t, tt.last, r.Last.String())
+
+		_, ipnet, _ := net.ParseCIDR(tt.cidr)
+		first, last, err := AddressRange(ipnet)
+		require.NoError(t, err)
+		require.Equal(t, tt.first, first.String())
+		require.Equal(t, tt.last, last.String())
+	}
+}
+
+func TestPrefixHostRange(t *testing.T) {
+	for _, tt := range []struct {
+		cidr                       string
+		skipNetwork, skipBroadcast bool
+		expected                   string
+	}{
+		{"192.168.0.0/24", true, true, "192.168.0.1-192.168.0.254"},
+		{"192.168.0.0/25", false, true, "192.168.0.0-192.168.0.126"},
+		{"192.168.0.0/23", true, false, "192.168.0.1-192.168.1.255"},
+		{"192.168.0.0/30", true, true, "192.168.0.1-192.168.0.2"},
+		{"192.168.0.0/31", true, true, "192.168.0.0-192.168.0.1"},
+		{"192.168.0.1/32", true, true, "192.168.0.1-192.168.0.1"},
+		{"2001:db8::/126", true, true, "2001:db8::1-2001:db8::2"},
+		{"2001:db8::/127", true, true, "2001:db8::-2001:db8::1"},
+	} {
+		r := PrefixHostRange(netip.MustParsePrefix(tt.cidr), tt.skipNetwork, tt.skipBroadcast)
+		require.Equal(t, tt.expected, r.String(), tt.cidr)
+	}
+}
+
+func TestSplitPrefixIntoN(t *testing.T) {
+	for _, tt := range []struct {
+		cidr string
+		n    int
+		want []string
+	}{
+		{"173.0.84.0/24", 10, []string{"173.0.84.0/27", "173.0.84.32/27", "173.0.84.64/27", "173.0.84.96/27", "173.0.84.128/27", "173.0.84.160/27", "173.0.84.192/27", "173.0.84.224/28", "173.0.84.240/29", "173.0.84.248/29"}},
+		{"10.0.0.0/30", 3, []string{"10.0.0.0/31", "10.0.0.2/32", "10.0.0.3/32"}},
+		{"2001:db8::/48", 3, []string{"2001:db8::/49", "2001:db8:0:8000::/50", "2001:db8:0:c000::/50"}},
+	} {
+		got, err := SplitPrefixIntoN(netip.MustParsePrefix(tt.cidr), tt.n)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, prefixStrings(got))
+
+		gotNets, err := SplitN(tt.cidr, tt.n)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, ipnetStrings(gotNets))
+	}
+
+	_, err := SplitPrefixIntoN(netip.MustParsePrefix("10.0.0.0/29"), 7)
+	require.Error(t, err)
+}
+
+func TestSplitPrefixByLength(t *testing.T) {
+	for _, tt := range []struct {
+		cidr string
+		bits int
+		want []string
+	}{
+		{"10.0.0.0/22", 24, []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}},
+		{"10.0.0.5/30", 31, []string{"10.0.0.4/31", "10.0.0.6/31"}},
+		{"10.0.0.0/24", 24, []string{"10.0.0.0/24"}},
+		{"255.255.255.252/30", 32, []string{"255.255.255.252/32", "255.255.255.253/32", "255.255.255.254/32", "255.255.255.255/32"}},
+		{"2001:db8::/46", 48, []string{"2001:db8::/48", "2001:db8:1::/48", "2001:db8:2::/48", "2001:db8:3::/48"}},
+		{"::/0", 0, []string{"::/0"}},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127", 128, []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/128", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"}},
+	} {
+		got, err := SplitPrefixByLength(netip.MustParsePrefix(tt.cidr), tt.bits)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, prefixStrings(got))
+	}
+
+	for _, tt := range []struct {
+		cidr string
+		bits int
+	}{{"10.0.0.0/24", 23}, {"10.0.0.0/24", 33}, {"2001:db8::/32", 129}} {
+		_, err := SplitPrefixByLengthSeq(netip.MustParsePrefix(tt.cidr), tt.bits)
+		require.Error(t, err)
+	}
+
+	// the sequence is lazy, an IPv6 /32 into /64s only yields what is read
+	prefix := netip.MustParsePrefix("2001:db8::/32")
+	count, err := SplitPrefixByLengthCount(prefix, 64)
+	require.NoError(t, err)
+	require.Equal(t, "4294967296", count.String())
+	_, err = SplitPrefixByLength(prefix, 64)
+	require.Error(t, err)
+	subnets, err := SplitPrefixByLengthSeq(prefix, 64)
+	require.NoError(t, err)
+	var got []string
+	for subnet := range subnets {
+		got = append(got, subnet.String())
+		if len(got) == 3 {
+			break
+		}
+	}
+	require.Equal(t, []string{"2001:db8::/64", "2001:db8:0:1::/64", "2001:db8:0:2::/64"}, got)
+}
+
+func TestSplitPrefixByRatio(t *testing.T) {
+	for _, tt := range []struct {
+		cidr    string
+		weights []int
+		maxBits int
+		want    [][]string
+	}{
+		{"10.0.0.0/16", []int{3, 1}, 0, [][]string{{"10.0.0.0/17", "10.0.128.0/18"}, {"10.0.192.0/18"}}},
+		{"10.0.0.0/16", []int{25, 50, 25}, 0, [][]string{{"10.0.128.0/18"}, {"10.0.0.0/17"}, {"10.0.192.0/18"}}},
+		{"10.0.0.0/24", []int{1, 1, 1}, 0, [][]string{{"10.0.0.0/26", "10.0.0.64/28", "10.0.0.80/30", "10.0.0.84/31"}, {"10.0.0.86/31", "10.0.0.88/29", "10.0.0.96/27", "10.0.0.128/27", "10.0.0.160/29", "10.0.0.168/31", "10.0.0.170/32"}, {"10.0.0.171/32", "10.0.0.172/30", "10.0.0.176/28", "10.0.0.192/26"}}},
+		{"10.0.0.0/24", []int{1, 1, 1}, 26, [][]string{{"10.0.0.0/25"}, {"10.0.0.128/26"}, {"10.0.0.192/26"}}},
+		{"10.0.0.0/24", []int{1, 0}, 0, [][]string{{"10.0.0.0/24"}, nil}},
+		{"2001:db8::/32", []int{1, 3}, 0, [][]string{{"2001:db8:c000::/34"}, {"2001:db8::/33", "2001:db8:8000::/34"}}},
+		{"::/0", []int{1}, 0, [][]string{{"::/0"}}},
+	} {
+		parts, err := SplitPrefixByRatio(netip.MustParsePrefix(tt.cidr), tt.weights, tt.maxBits)
+		require.NoError(t, err, tt.cidr)
+		var got [][]string
+		for _, part := range parts {
+			got = append(got, prefixStrings(part))
+		}
+		require.Equal(t, tt.want, got, tt.cidr)
+	}
+
+	// five parts don't fit in four /26
+	_, err := SplitPrefixByRatio(netip.MustParsePrefix("10.0.0.0/24"), []int{1, 1, 1, 1, 1}, 26)
+	require.Error(t, err)
+	_, err = SplitPrefixByRatio(netip.MustParsePrefix("10.0.0.0/24"), []int{1, 1}, 23)
+	require.Error(t, err)
+	_, err = SplitPrefixByRatio(netip.MustParsePrefix("10.0.0.0/24"), []int{1, -1}, 0)
+	require.Error(t, err)
+}
+
+func TestPrefixesFromRange(t *testing.T) {
+	got, err := PrefixesFromRange(netip.MustParseAddr("192.168.0.1"), netip.MustParseAddr("192.168.0.255"))
+	require.NoError(t, err)
+	want := []string{"192.168.0.1/32", "192.168.0.2/31", "192.168.0.4/30", "192.168.0.8/29",
+		"192.168.0.16/28", "192.168.0.32/27", "192.168.0.64/26", "192.168.0.128/25"}
+	require.Equal(t, want, prefixStrings(got))
+
+	got, err = PrefixesFromRange(netip.MustParseAddr("::"), netip.MustParseAddr("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"::/0"}, prefixStrings(got))
+
+	_, err = PrefixesFromRange(netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("::1"))
+	require.Error(t, err)
+	_, err = PrefixesFromRange(netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("10.0.0.1"))
+	require.Error(t, err)
+}
+
+func TestCoalescePrefixes(t *testing.T) {
+	cidrs := []string{"10.40.0.0/30", "10.40.0.4/30", "10.40.0.8/30", "10.40.0.12/30", "10.40.0.4/32", "2001:db8::/33", "2001:db8:8000::/33", "192.168.0.0/24"}
+
+	var prefixes []netip.Prefix
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		prefixes = append(prefixes, netip.MustParsePrefix(cidr))
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+
+	v4, v6 := CoalescePrefixes(prefixes)
+	require.Equal(t, []string{"10.40.0.0/28", "192.168.0.0/24"}, prefixStrings(v4))
+	require.Equal(t, []string{"2001:db8::/32"}, prefixStrings(v6))
+
+	// both APIs return the same set
+	netsV4, netsV6 := CoalesceCIDRs(networks)
+	gotV4 := ipnetStrings(netsV4)
+	sort.Strings(gotV4)
+	require.Equal(t, prefixStrings(v4), gotV4)
+	require.Equal(t, prefixStrings(v6), ipnetStrings(netsV6))
+}
+
+func TestRemovePrefixes(t *testing.T) {
+	allow := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/30")}
+	remove := []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}
+	got, err := RemovePrefixes(allow, remove)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/32", "10.0.0.2/31"}, prefixStrings(got))
+
+	_, allowNet, _ := net.ParseCIDR("10.0.0.0/30")
+	_, removeNet, _ := net.ParseCIDR("10.0.0.1/32")
+	gotNets, err := RemoveCIDRs([]*net.IPNet{allowNet}, []*net.IPNet{removeNet})
+	require.NoError(t, err)
+	require.Equal(t, prefixStrings(got), ipnetStrings(gotNets))
+
+	// a remove prefix larger than the allowed one drops it
+	got, err = RemovePrefixes([]netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	// families are subtracted separately and the inputs are left untouched
+	allow = []netip.Prefix{netip.MustParsePrefix("2001:db8::/126"), netip.MustParsePrefix("10.0.0.0/24")}
+	remove = []netip.Prefix{netip.MustParsePrefix("10.0.0.128/25"), netip.MustParsePrefix("2001:db8::1/128"), netip.MustParsePrefix("192.168.0.0/16")}
+	got, err = RemovePrefixes(allow, remove)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/25", "2001:db8::/128", "2001:db8::2/127"}, prefixStrings(got))
+	require.Equal(t, []string{"2001:db8::/126", "10.0.0.0/24"}, prefixStrings(allow))
+	require.Equal(t, []string{"10.0.0.128/25", "2001:db8::1/128", "192.168.0.0/16"}, prefixStrings(remove))
+
+	_, err = RemovePrefixes([]netip.Prefix{{}}, nil)
+	require.Error(t, err)
+}
+
+func TestFreeSpace(t *testing.T) {
+	pools := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/16"), netip.MustParsePrefix("2001:db8::/32")}
+	used := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("10.0.2.0/23"),
+		netip.MustParsePrefix("10.0.128.0/17"),
+		netip.MustParsePrefix("2001:db8::/33"),
+		// outside of the pools
+		netip.MustParsePrefix("192.168.0.0/24"),
+	}
+	free := FreeSpace(pools, used)
+	require.Equal(t, []string{"10.0.1.0/24", "10.0.4.0/22", "10.0.8.0/21", "10.0.16.0/20", "10.0.32.0/19", "10.0.64.0/18", "2001:db8:8000::/33"}, prefixStrings(free.Prefixes()))
+	require.Equal(t, "10.0.1.0-10.0.1.255", free.Ranges()[0].String())
+	require.Equal(t, "10.0.4.0-10.0.127.255", free.Ranges()[1].String())
+
+	for _, tt := range []struct {
+		bits     int
+		expected string
+	}{
+		{24, "10.0.1.0/24"},
+		{23, "10.0.4.0/23"},
+		{18, "10.0.64.0/18"},
+		{33, "2001:db8:8000::/33"},
+	} {
+		prefix, err := NextFreePrefix(pools, used, tt.bits)
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, prefix.String())
+	}
+	_, err := NextFreePrefix(pools, used, 17)
+	require.Error(t, err)
+}
+
+func TestRemovePrefixesLargeLists(t *testing.T) {
+	var allow, remove []netip.Prefix
+	for i := 0; i < 4096; i++ {
+		allow = append(allow, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 4), byte(i << 4), 0}), 20))
+		remove = append(remove, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 4), byte(i << 4), 128}), 25))
+	}
+	got, err := RemovePrefixes(allow, remove)
+	require.NoError(t, err)
+	require.Equal(t, int64(4096*(4096-128)), IPSetFromPrefixes(got).Count().Int64())
+	require.False(t, IPSetFromPrefixes(got).Overlaps(IPSetFromPrefixes(remove)))
+}
+
+func TestShufflePrefixesWithSeed(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.168.0.0/30"), netip.MustParsePrefix("10.0.0.0/31")}
+	var got []string
+	for addr := range ShufflePrefixesWithSeed(prefixes, 42) {
+		got = append(got, addr.String())
+	}
+	require.ElementsMatch(t, []string{"10.0.0.0", "10.0.0.1", "192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3"}, got)
+
+	// the net.IPNet API visits the addresses in the same order
+	var gotItems []string
+	for item := range ShuffleCidrsWithSeed(IPNetsFromPrefixes(prefixes), 42) {
+		gotItems = append(gotItems, item.IP)
+	}
+	require.Equal(t, got, gotItems)
+}
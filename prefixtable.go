@@ -0,0 +1,248 @@
+package mapcidr
+
+import (
+	"iter"
+	"net/netip"
+)
+
+// PrefixTable maps IPv4 and IPv6 prefixes to values and finds the longest
+// prefix matching an address. It is a path-compressed binary trie, so
+// lookups cost at most one node per distinct prefix length on the path and
+// don't allocate. The zero value is an empty table ready to use. A
+// PrefixTable is not safe for concurrent writes.
+type PrefixTable[V any] struct {
+	root4, root6 *tableNode[V]
+	len          int
+}
+
+type tableNode[V any] struct {
+	// key is the network address shifted to the left end of the 128 bits,
+	// so that IPv4 and IPv6 bits are indexed the same way
+	key      uint128
+	bits     int
+	value    V
+	hasValue bool
+	children [2]*tableNode[V]
+}
+
+// tableKey returns the trie key of the masked prefix.
+func tableKey(prefix netip.Prefix) (key uint128, bits int, is4 bool) {
+	addr := prefix.Masked().Addr()
+	return u128FromAddr(addr).lsh(uint(128 - addr.BitLen())), prefix.Bits(), addr.Is4()
+}
+
+// commonPrefixLen returns the number of leading bits shared by u and v.
+func commonPrefixLen(u, v uint128) int {
+	return 128 - u.xor(v).bitLen()
+}
+
+func (t *PrefixTable[V]) rootSlot(is4 bool) **tableNode[V] {
+	if is4 {
+		return &t.root4
+	}
+	return &t.root6
+}
+
+// Len returns the number of prefixes in the table.
+func (t *PrefixTable[V]) Len() int {
+	return t.len
+}
+
+// Insert sets the value of the prefix, replacing the previous one if any.
+// The prefix is masked first; invalid prefixes are ignored.
+func (t *PrefixTable[V]) Insert(prefix netip.Prefix, value V) {
+	if !prefix.IsValid() {
+		return
+	}
+	key, bits, is4 := tableKey(prefix)
+	slot := t.rootSlot(is4)
+	for {
+		n := *slot
+		if n == nil {
+			*slot = &tableNode[V]{key: key, bits: bits, value: value, hasValue: true}
+			t.len++
+			return
+		}
+		common := min(commonPrefixLen(n.key, key), n.bits, bits)
+		if common == n.bits {
+			if n.bits == bits {
+				if !n.hasValue {
+					t.len++
+				}
+				n.value, n.hasValue = value, true
+				return
+			}
+			slot = &n.children[key.bit(n.bits)]
+			continue
+		}
+
+		leaf := &tableNode[V]{key: key, bits: bits, value: value, hasValue: true}
+		if common == bits {
+			// the new prefix covers n
+			leaf.children[n.key.bit(bits)] = n
+			*slot = leaf
+		} else {
+			// join both under a value-less node at the first differing bit
+			glue := &tableNode[V]{key: key.and(hostMask(128 - common).not()), bits: common}
+			glue.children[key.bit(common)] = leaf
+			glue.children[n.key.bit(common)] = n
+			*slot = glue
+		}
+		t.len++
+		return
+	}
+}
+
+// Delete removes the prefix from the table and reports whether it was
+// present.
+func (t *PrefixTable[V]) Delete(prefix netip.Prefix) bool {
+	if !prefix.IsValid() {
+		return false
+	}
+	key, bits, is4 := tableKey(prefix)
+	var parentSlot **tableNode[V]
+	slot := t.rootSlot(is4)
+	for {
+		n := *slot
+		if n == nil || n.bits > bits || commonPrefixLen(n.key, key) < n.bits {
+			return false
+		}
+		if n.bits == bits {
+			if !n.hasValue {
+				return false
+			}
+			var zero V
+			n.value, n.hasValue = zero, false
+			t.len--
+			compactNode(slot)
+			if parentSlot != nil {
+				compactNode(parentSlot)
+			}
+			return true
+		}
+		parentSlot, slot = slot, &n.children[key.bit(n.bits)]
+	}
+}
+
+// compactNode drops the value-less node at slot if it has less than two
+// children, moving its child up.
+func compactNode[V any](slot **tableNode[V]) {
+	n := *slot
+	switch {
+	case n.hasValue:
+	case n.children[0] == nil:
+		*slot = n.children[1]
+	case n.children[1] == nil:
+		*slot = n.children[0]
+	}
+}
+
+// Get returns the value of exactly the given prefix.
+func (t *PrefixTable[V]) Get(prefix netip.Prefix) (V, bool) {
+	var zero V
+	if !prefix.IsValid() {
+		return zero, false
+	}
+	key, bits, is4 := tableKey(prefix)
+	for n := *t.rootSlot(is4); n != nil && n.bits <= bits && commonPrefixLen(n.key, key) >= n.bits; n = n.children[key.bit(n.bits)] {
+		if n.bits == bits {
+			return n.value, n.hasValue
+		}
+	}
+	return zero, false
+}
+
+// Lookup returns the longest prefix of the table containing addr, and its
+// value.
+func (t *PrefixTable[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	var (
+		match *tableNode[V]
+		zero  V
+	)
+	if !addr.IsValid() {
+		return netip.Prefix{}, zero, false
+	}
+	key, bits, is4 := tableKey(netip.PrefixFrom(addr, addr.BitLen()))
+	for n := *t.rootSlot(is4); n != nil && commonPrefixLen(n.key, key) >= n.bits; {
+		if n.hasValue {
+			match = n
+		}
+		if n.bits == bits {
+			break
+		}
+		n = n.children[key.bit(n.bits)]
+	}
+	if match == nil {
+		return netip.Prefix{}, zero, false
+	}
+	return match.prefix(is4), match.value, true
+}
+
+// Covering returns an iterator over the prefixes of the table containing the
+// given prefix, itself included, from the shortest to the longest.
+func (t *PrefixTable[V]) Covering(prefix netip.Prefix) iter.Seq2[netip.Prefix, V] {
+	return func(yield func(netip.Prefix, V) bool) {
+		if !prefix.IsValid() {
+			return
+		}
+		key, bits, is4 := tableKey(prefix)
+		for n := *t.rootSlot(is4); n != nil && n.bits <= bits && commonPrefixLen(n.key, key) >= n.bits; {
+			if n.hasValue && !yield(n.prefix(is4), n.value) {
+				return
+			}
+			if n.bits == bits {
+				return
+			}
+			n = n.children[key.bit(n.bits)]
+		}
+	}
+}
+
+// Covered returns an iterator over the prefixes of the table contained in
+// the given prefix, itself included, sorted by address and then by length.
+func (t *PrefixTable[V]) Covered(prefix netip.Prefix) iter.Seq2[netip.Prefix, V] {
+	return func(yield func(netip.Prefix, V) bool) {
+		if !prefix.IsValid() {
+			return
+		}
+		key, bits, is4 := tableKey(prefix)
+		n := *t.rootSlot(is4)
+		for n != nil && n.bits < bits {
+			if commonPrefixLen(n.key, key) < n.bits {
+				return
+			}
+			n = n.children[key.bit(n.bits)]
+		}
+		// the subtree of n is within the prefix if n is
+		if n != nil && commonPrefixLen(n.key, key) >= bits {
+			n.walk(is4, yield)
+		}
+	}
+}
+
+// All returns an iterator over the prefixes of the table and their values,
+// IPv4 before IPv6, sorted by address and then by length.
+func (t *PrefixTable[V]) All() iter.Seq2[netip.Prefix, V] {
+	return func(yield func(netip.Prefix, V) bool) {
+		_ = t.root4.walk(true, yield) && t.root6.walk(false, yield)
+	}
+}
+
+// walk visits the node and its children in order until yield returns false.
+func (n *tableNode[V]) walk(is4 bool, yield func(netip.Prefix, V) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.hasValue && !yield(n.prefix(is4), n.value) {
+		return false
+	}
+	return n.children[0].walk(is4, yield) && n.children[1].walk(is4, yield)
+}
+
+func (n *tableNode[V]) prefix(is4 bool) netip.Prefix {
+	familyBits := 128
+	if is4 {
+		familyBits = 32
+	}
+	return netip.PrefixFrom(n.key.rsh(uint(128-familyBits)).addr(is4), n.bits)
+}
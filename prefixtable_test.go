@@ -0,0 +1,138 @@
+package mapcidr
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixTable(t *testing.T) {
+	var table PrefixTable[string]
+	for _, cidr := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.168.0.0/16", "0.0.0.0/0", "2001:db8::/32", "2001:db8:1::/48"} {
+		table.Insert(netip.MustParsePrefix(cidr), cidr)
+	}
+	require.Equal(t, 7, table.Len())
+
+	for _, tt := range []struct{ addr, want string }{
+		{"10.1.2.3", "10.1.2.0/24"},
+		{"10.1.3.3", "10.1.0.0/16"},
+		{"10.2.0.1", "10.0.0.0/8"},
+		{"8.8.8.8", "0.0.0.0/0"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db8:2::1", "2001:db8::/32"},
+	} {
+		prefix, value, ok := table.Lookup(netip.MustParseAddr(tt.addr))
+		require.True(t, ok, tt.addr)
+		require.Equal(t, tt.want, prefix.String())
+		require.Equal(t, tt.want, value)
+	}
+	_, _, ok := table.Lookup(netip.MustParseAddr("2001:db9::1"))
+	require.False(t, ok)
+
+	value, ok := table.Get(netip.MustParsePrefix("10.1.0.0/16"))
+	require.True(t, ok)
+	require.Equal(t, "10.1.0.0/16", value)
+	_, ok = table.Get(netip.MustParsePrefix("10.1.0.0/17"))
+	require.False(t, ok)
+
+	var covering []string
+	for prefix := range table.Covering(netip.MustParsePrefix("10.1.2.128/25")) {
+		covering = append(covering, prefix.String())
+	}
+	require.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"}, covering)
+
+	var covered []string
+	for prefix := range table.Covered(netip.MustParsePrefix("10.0.0.0/7")) {
+		covered = append(covered, prefix.String())
+	}
+	require.Equal(t, []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"}, covered)
+	covered = nil
+	for prefix := range table.Covered(netip.MustParsePrefix("10.1.0.0/16")) {
+		covered = append(covered, prefix.String())
+	}
+	require.Equal(t, []string{"10.1.0.0/16", "10.1.2.0/24"}, covered)
+	for prefix := range table.Covered(netip.MustParsePrefix("10.1.3.0/24")) {
+		require.Fail(t, "unexpected covered prefix", prefix.String())
+	}
+
+	var all []string
+	for prefix := range table.All() {
+		all = append(all, prefix.String())
+	}
+	require.Equal(t, []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.168.0.0/16", "2001:db8::/32", "2001:db8:1::/48"}, all)
+
+	require.True(t, table.Delete(netip.MustParsePrefix("10.1.0.0/16")))
+	require.False(t, table.Delete(netip.MustParsePrefix("10.1.0.0/16")))
+	prefix, _, _ := table.Lookup(netip.MustParseAddr("10.1.3.3"))
+	require.Equal(t, "10.0.0.0/8", prefix.String())
+	require.Equal(t, 6, table.Len())
+
+	// inserting an existing prefix replaces its value
+	table.Insert(netip.MustParsePrefix("10.0.0.1/8"), "ten")
+	value, _ = table.Get(netip.MustParsePrefix("10.0.0.0/8"))
+	require.Equal(t, "ten", value)
+	require.Equal(t, 6, table.Len())
+}
+
+func TestPrefixTableRandom(t *testing.T) {
+	// compare the longest prefix match with a linear scan
+	r := rand.New(rand.NewSource(1))
+	var table PrefixTable[int]
+	var prefixes []netip.Prefix
+	for i := 0; i < 2000; i++ {
+		addr := netip.AddrFrom4([4]byte{10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256))})
+		prefix := netip.PrefixFrom(addr, 8+r.Intn(25)).Masked()
+		table.Insert(prefix, i)
+		prefixes = append(prefixes, prefix)
+	}
+	live := make(map[netip.Prefix]bool)
+	for _, prefix := range prefixes {
+		live[prefix] = true
+	}
+	for i := 0; i < len(prefixes); i += 3 {
+		table.Delete(prefixes[i])
+		live[prefixes[i]] = false
+	}
+	count := 0
+	for _, ok := range live {
+		if ok {
+			count++
+		}
+	}
+	require.Equal(t, count, table.Len())
+
+	for i := 0; i < 5000; i++ {
+		addr := netip.AddrFrom4([4]byte{10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256))})
+		want := -1
+		for prefix, ok := range live {
+			if ok && prefix.Contains(addr) && prefix.Bits() > want {
+				want = prefix.Bits()
+			}
+		}
+		got, _, ok := table.Lookup(addr)
+		if want < 0 {
+			require.False(t, ok)
+		} else {
+			require.True(t, ok)
+			require.Equal(t, want, got.Bits(), addr.String())
+		}
+	}
+	for i := 0; i < 500; i++ {
+		addr := netip.AddrFrom4([4]byte{10, byte(r.Intn(4)), byte(r.Intn(256)), byte(r.Intn(256))})
+		query := netip.PrefixFrom(addr, 8+r.Intn(25)).Masked()
+		want := 0
+		for prefix, ok := range live {
+			if ok && query.Bits() <= prefix.Bits() && query.Contains(prefix.Addr()) {
+				want++
+			}
+		}
+		got := 0
+		for prefix := range table.Covered(query) {
+			require.True(t, query.Contains(prefix.Addr()) && query.Bits() <= prefix.Bits())
+			got++
+		}
+		require.Equal(t, want, got, query.String())
+	}
+}
@@ -0,0 +1,227 @@
+package mapcidr
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// Category is a kind of address, as assigned by the IANA special-purpose
+// address registries.
+type Category string
+
+const (
+	CategoryPrivate       Category = "private"
+	CategoryCGNAT         Category = "cgnat"
+	CategoryLoopback      Category = "loopback"
+	CategoryLinkLocal     Category = "link-local"
+	CategoryMulticast     Category = "multicast"
+	CategoryDocumentation Category = "documentation"
+	CategoryBenchmarking  Category = "benchmarking"
+	CategoryReserved      Category = "reserved"
+	CategoryULA           Category = "ula"
+	Category6to4          Category = "6to4"
+	CategoryTeredo        Category = "teredo"
+	CategoryGlobalUnicast Category = "global-unicast"
+)
+
+// SpecialPurposeBlock is an entry of the IANA IPv4 and IPv6 special-purpose
+// address registries.
+type SpecialPurposeBlock struct {
+	Prefix   netip.Prefix
+	Name     string
+	RFC      string
+	Category Category
+	// GloballyReachable reports whether the addresses of the block are
+	// meant to be reachable on the internet
+	GloballyReachable bool
+}
+
+// specialPurposeBlocks holds the IANA IPv4 and IPv6 special-purpose address
+// registries, along with the multicast blocks of the address space
+// registries.
+var specialPurposeBlocks = []SpecialPurposeBlock{
+	{netip.MustParsePrefix("0.0.0.0/8"), "This network", "RFC 791", CategoryReserved, false},
+	{netip.MustParsePrefix("0.0.0.0/32"), "This host on this network", "RFC 1122", CategoryReserved, false},
+	{netip.MustParsePrefix("10.0.0.0/8"), "Private-Use", "RFC 1918", CategoryPrivate, false},
+	{netip.MustParsePrefix("100.64.0.0/10"), "Shared Address Space", "RFC 6598", CategoryCGNAT, false},
+	{netip.MustParsePrefix("127.0.0.0/8"), "Loopback", "RFC 1122", CategoryLoopback, false},
+	{netip.MustParsePrefix("169.254.0.0/16"), "Link Local", "RFC 3927", CategoryLinkLocal, false},
+	{netip.MustParsePrefix("172.16.0.0/12"), "Private-Use", "RFC 1918", CategoryPrivate, false},
+	{netip.MustParsePrefix("192.0.0.0/24"), "IETF Protocol Assignments", "RFC 6890", CategoryReserved, false},
+	{netip.MustParsePrefix("192.0.0.0/29"), "IPv4 Service Continuity Prefix", "RFC 7335", CategoryReserved, false},
+	{netip.MustParsePrefix("192.0.0.8/32"), "IPv4 dummy address", "RFC 7600", CategoryReserved, false},
+	{netip.MustParsePrefix("192.0.0.9/32"), "Port Control Protocol Anycast", "RFC 7723", CategoryReserved, true},
+	{netip.MustParsePrefix("192.0.0.10/32"), "Traversal Using Relays around NAT Anycast", "RFC 8155", CategoryReserved, true},
+	{netip.MustParsePrefix("192.0.0.170/32"), "NAT64/DNS64 Discovery", "RFC 8880", CategoryReserved, false},
+	{netip.MustParsePrefix("192.0.0.171/32"), "NAT64/DNS64 Discovery", "RFC 8880", CategoryReserved, false},
+	{netip.MustParsePrefix("192.0.2.0/24"), "Documentation (TEST-NET-1)", "RFC 5737", CategoryDocumentation, false},
+	{netip.MustParsePrefix("192.31.196.0/24"), "AS112-v4", "RFC 7535", CategoryReserved, true},
+	{netip.MustParsePrefix("192.52.193.0/24"), "AMT", "RFC 7450", CategoryReserved, true},
+	{netip.MustParsePrefix("192.88.99.0/24"), "Deprecated (6to4 Relay Anycast)", "RFC 7526", Category6to4, false},
+	{netip.MustParsePrefix("192.168.0.0/16"), "Private-Use", "RFC 1918", CategoryPrivate, false},
+	{netip.MustParsePrefix("192.175.48.0/24"), "Direct Delegation AS112 Service", "RFC 7534", CategoryReserved, true},
+	{netip.MustParsePrefix("198.18.0.0/15"), "Benchmarking", "RFC 2544", CategoryBenchmarking, false},
+	{netip.MustParsePrefix("198.51.100.0/24"), "Documentation (TEST-NET-2)", "RFC 5737", CategoryDocumentation, false},
+	{netip.MustParsePrefix("203.0.113.0/24"), "Documentation (TEST-NET-3)", "RFC 5737", CategoryDocumentation, false},
+	{netip.MustParsePrefix("224.0.0.0/4"), "Multicast", "RFC 5771", CategoryMulticast, false},
+	{netip.MustParsePrefix("233.252.0.0/24"), "Documentation (MCAST-TEST-NET)", "RFC 6676", CategoryDocumentation, false},
+	{netip.MustParsePrefix("240.0.0.0/4"), "Reserved", "RFC 1112", CategoryReserved, false},
+	{netip.MustParsePrefix("255.255.255.255/32"), "Limited Broadcast", "RFC 919", CategoryReserved, false},
+
+	{netip.MustParsePrefix("::/128"), "Unspecified Address", "RFC 4291", CategoryReserved, false},
+	{netip.MustParsePrefix("::1/128"), "Loopback Address", "RFC 4291", CategoryLoopback, false},
+	{netip.MustParsePrefix("::ffff:0:0/96"), "IPv4-mapped Address", "RFC 4291", CategoryReserved, false},
+	{netip.MustParsePrefix("64:ff9b::/96"), "IPv4-IPv6 Translation", "RFC 6052", CategoryReserved, true},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "IPv4-IPv6 Translation", "RFC 8215", CategoryReserved, false},
+	{netip.MustParsePrefix("100::/64"), "Discard-Only Address Block", "RFC 6666", CategoryReserved, false},
+	{netip.MustParsePrefix("2001::/23"), "IETF Protocol Assignments", "RFC 2928", CategoryReserved, false},
+	{netip.MustParsePrefix("2001::/32"), "TEREDO", "RFC 4380", CategoryTeredo, false},
+	{netip.MustParsePrefix("2001:1::1/128"), "Port Control Protocol Anycast", "RFC 7723", CategoryReserved, true},
+	{netip.MustParsePrefix("2001:1::2/128"), "Traversal Using Relays around NAT Anycast", "RFC 8155", CategoryReserved, true},
+	{netip.MustParsePrefix("2001:2::/48"), "Benchmarking", "RFC 5180", CategoryBenchmarking, false},
+	{netip.MustParsePrefix("2001:3::/32"), "AMT", "RFC 7450", CategoryReserved, true},
+	{netip.MustParsePrefix("2001:4:112::/48"), "AS112-v6", "RFC 7535", CategoryReserved, true},
+	{netip.MustParsePrefix("2001:10::/28"), "Deprecated (previously ORCHID)", "RFC 4843", CategoryReserved, false},
+	{netip.MustParsePrefix("2001:20::/28"), "ORCHIDv2", "RFC 7343", CategoryReserved, true},
+	{netip.MustParsePrefix("2001:30::/28"), "Drone Remote ID Protocol Entity Tags (DETs) Prefix", "RFC 9374", CategoryReserved, true},
+	{netip.MustParsePrefix("2001:db8::/32"), "Documentation", "RFC 3849", CategoryDocumentation, false},
+	{netip.MustParsePrefix("2002::/16"), "6to4", "RFC 3056", Category6to4, false},
+	{netip.MustParsePrefix("2620:4f:8000::/48"), "Direct Delegation AS112 Service", "RFC 7534", CategoryReserved, true},
+	{netip.MustParsePrefix("3fff::/20"), "Documentation", "RFC 9637", CategoryDocumentation, false},
+	{netip.MustParsePrefix("5f00::/16"), "Segment Routing (SRv6) SIDs", "RFC 9602", CategoryReserved, false},
+	{netip.MustParsePrefix("fc00::/7"), "Unique-Local", "RFC 4193", CategoryULA, false},
+	{netip.MustParsePrefix("fe80::/10"), "Link-Local Unicast", "RFC 4291", CategoryLinkLocal, false},
+	{netip.MustParsePrefix("ff00::/8"), "Multicast", "RFC 4291", CategoryMulticast, false},
+}
+
+// addressSpaceBlocks classify the addresses out of the special-purpose
+// blocks: all of them for IPv4, and the global unicast space for IPv6, the
+// rest of which is reserved by the IETF.
+var addressSpaceBlocks = []SpecialPurposeBlock{
+	{netip.MustParsePrefix("0.0.0.0/0"), "Global Unicast", "RFC 791", CategoryGlobalUnicast, true},
+	{netip.MustParsePrefix("::/0"), "Reserved by IETF", "RFC 4291", CategoryReserved, false},
+	{netip.MustParsePrefix("2000::/3"), "Global Unicast", "RFC 4291", CategoryGlobalUnicast, true},
+}
+
+// registry maps the prefixes of all the blocks to their entry.
+var registry = func() *PrefixTable[SpecialPurposeBlock] {
+	table := &PrefixTable[SpecialPurposeBlock]{}
+	for _, block := range slices.Concat(addressSpaceBlocks, specialPurposeBlocks) {
+		table.Insert(block.Prefix, block)
+	}
+	return table
+}()
+
+// SpecialPurposeBlocks returns the entries of the embedded IANA IPv4 and IPv6
+// special-purpose address registries, IPv4 before IPv6, sorted by address.
+func SpecialPurposeBlocks() []SpecialPurposeBlock {
+	return slices.Clone(specialPurposeBlocks)
+}
+
+// Classification is a category of some addresses of a classified prefix.
+type Classification struct {
+	Category Category
+	// Block is the most specific registry block containing the addresses
+	Block SpecialPurposeBlock
+	// Partial reports whether the category only applies to part of the
+	// classified prefix
+	Partial bool
+}
+
+// Classify returns the categories of the addresses of the prefix, each
+// address getting the category of the most specific registry block
+// containing it. A prefix overlapping several blocks gets one partial
+// classification per block, the block containing the whole prefix first,
+// then the others in address order. IPv4-mapped IPv6 prefixes of at least
+// 96 bits are classified as IPv4 prefixes. Classify returns nil for an
+// invalid prefix.
+func Classify(prefix netip.Prefix) []Classification {
+	if !prefix.IsValid() {
+		return nil
+	}
+	if addr := prefix.Addr(); addr.Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+	}
+	prefix = prefix.Masked()
+	var base SpecialPurposeBlock
+	for _, block := range registry.Covering(prefix) {
+		base = block
+	}
+	var inner []SpecialPurposeBlock
+	for p, block := range registry.Covered(prefix) {
+		if p.Bits() > prefix.Bits() {
+			inner = append(inner, block)
+		}
+	}
+
+	whole := IPSetFromPrefixes([]netip.Prefix{prefix})
+	var classifications []Classification
+	for i, block := range slices.Concat([]SpecialPurposeBlock{base}, inner) {
+		// the addresses of the block not in a more specific one
+		var more []netip.Prefix
+		for _, other := range inner {
+			if other.Prefix.Bits() > block.Prefix.Bits() && block.Prefix.Contains(other.Prefix.Addr()) {
+				more = append(more, other.Prefix)
+			}
+		}
+		addrs := whole
+		if i > 0 {
+			addrs = IPSetFromPrefixes([]netip.Prefix{block.Prefix})
+		}
+		addrs = addrs.Difference(IPSetFromPrefixes(more))
+		if addrs.IsEmpty() {
+			continue
+		}
+		classifications = append(classifications, Classification{
+			Category: block.Category,
+			Block:    block,
+			Partial:  !addrs.Equal(whole),
+		})
+	}
+	return classifications
+}
+
+// ClassifyAddr returns the category of the address and the most specific
+// registry block containing it, or the zero Classification for an invalid
+// address. IPv4-mapped IPv6 addresses are classified as IPv4 addresses, as
+// IPSet holds them.
+func ClassifyAddr(addr netip.Addr) Classification {
+	_, block, _ := registry.Lookup(addr.Unmap().WithZone(""))
+	return Classification{Category: block.Category, Block: block}
+}
+
+// SpecialPurposeSet returns the addresses whose most specific registry
+// block, the global unicast and IETF reserved spaces included, satisfies
+// match.
+func SpecialPurposeSet(match func(SpecialPurposeBlock) bool) IPSet {
+	var blocks []SpecialPurposeBlock
+	for _, block := range registry.All() {
+		// the sets hold the IPv4-mapped addresses as IPv4 addresses, which
+		// their own blocks classify
+		if block.Prefix.Addr().Is4In6() {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	// more specific blocks override the ones containing them
+	slices.SortStableFunc(blocks, func(a, b SpecialPurposeBlock) int {
+		return a.Prefix.Bits() - b.Prefix.Bits()
+	})
+	var set IPSet
+	for _, block := range blocks {
+		addrs := IPSetFromPrefixes([]netip.Prefix{block.Prefix})
+		if match(block) {
+			set = set.Union(addrs)
+		} else {
+			set = set.Difference(addrs)
+		}
+	}
+	return set
+}
+
+// CategorySet returns the addresses classified in one of the categories.
+func CategorySet(categories ...Category) IPSet {
+	return SpecialPurposeSet(func(block SpecialPurposeBlock) bool {
+		return slices.Contains(categories, block.Category)
+	})
+}
@@ -0,0 +1,118 @@
+package mapcidr
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	for _, tt := range []struct {
+		addr     string
+		expected Category
+	}{
+		{"10.1.2.3", CategoryPrivate},
+		{"172.31.255.255", CategoryPrivate},
+		{"172.32.0.1", CategoryGlobalUnicast},
+		{"192.168.0.1", CategoryPrivate},
+		{"100.64.0.1", CategoryCGNAT},
+		{"127.0.0.1", CategoryLoopback},
+		{"169.254.169.254", CategoryLinkLocal},
+		{"224.0.0.251", CategoryMulticast},
+		{"233.252.0.1", CategoryDocumentation},
+		{"192.0.2.10", CategoryDocumentation},
+		{"198.19.0.1", CategoryBenchmarking},
+		{"0.0.0.0", CategoryReserved},
+		{"240.0.0.1", CategoryReserved},
+		{"255.255.255.255", CategoryReserved},
+		{"192.88.99.1", Category6to4},
+		{"8.8.8.8", CategoryGlobalUnicast},
+		{"::1", CategoryLoopback},
+		{"::", CategoryReserved},
+		{"::ffff:10.0.0.1", CategoryPrivate},
+		{"::ffff:8.8.8.8", CategoryGlobalUnicast},
+		{"fd00::1", CategoryULA},
+		{"fe80::1%eth0", CategoryLinkLocal},
+		{"ff02::1", CategoryMulticast},
+		{"2001:db8::1", CategoryDocumentation},
+		{"3fff::1", CategoryDocumentation},
+		{"2001:2::1", CategoryBenchmarking},
+		{"2001:0:4136:e378::1", CategoryTeredo},
+		{"2002:c000:0204::1", Category6to4},
+		{"2001:4860:4860::8888", CategoryGlobalUnicast},
+		{"4000::1", CategoryReserved},
+	} {
+		require.Equal(t, tt.expected, ClassifyAddr(netip.MustParseAddr(tt.addr)).Category, tt.addr)
+	}
+
+	classification := ClassifyAddr(netip.MustParseAddr("192.0.0.9"))
+	require.Equal(t, "Port Control Protocol Anycast", classification.Block.Name)
+	require.True(t, classification.Block.GloballyReachable)
+	require.Equal(t, Classification{}, ClassifyAddr(netip.Addr{}))
+}
+
+func TestClassify(t *testing.T) {
+	classify := func(cidr string) []string {
+		var s []string
+		for _, classification := range Classify(netip.MustParsePrefix(cidr)) {
+			item := string(classification.Category) + " " + classification.Block.Prefix.String()
+			if classification.Partial {
+				item += " partial"
+			}
+			s = append(s, item)
+		}
+		return s
+	}
+
+	require.Equal(t, []string{"private 10.0.0.0/8"}, classify("10.1.0.0/16"))
+	require.Equal(t, []string{"private 10.0.0.0/8"}, classify("10.0.0.0/8"))
+	require.Equal(t, []string{"global-unicast 0.0.0.0/0 partial", "private 10.0.0.0/8 partial"}, classify("10.0.0.0/7"))
+	require.Equal(t, []string{"global-unicast 0.0.0.0/0"}, classify("8.8.8.0/24"))
+	require.Equal(t, []string{
+		"reserved 192.0.0.0/24 partial",
+		"reserved 192.0.0.0/29 partial",
+		"reserved 192.0.0.8/32 partial",
+		"reserved 192.0.0.9/32 partial",
+		"reserved 192.0.0.10/32 partial",
+		"reserved 192.0.0.170/32 partial",
+		"reserved 192.0.0.171/32 partial",
+	}, classify("192.0.0.0/24"))
+	// blocks fully hidden by more specific ones are left out
+	require.Equal(t, []string{"reserved 0.0.0.0/32"}, classify("0.0.0.0/32"))
+	require.Equal(t, []string{"reserved ::/0 partial", "ula fc00::/7 partial", "link-local fe80::/10 partial", "multicast ff00::/8 partial"}, classify("8000::/1"))
+	require.Equal(t, []string{"global-unicast 2000::/3 partial", "reserved 2001::/23 partial", "teredo 2001::/32 partial"}, classify("2000::/7")[:3])
+	require.Equal(t, []string{"documentation 2001:db8::/32"}, classify("2001:db8:1::/48"))
+	require.Equal(t, []string{"private 10.0.0.0/8"}, classify("::ffff:10.1.0.0/112"))
+	require.Nil(t, Classify(netip.Prefix{}))
+}
+
+func TestCategorySet(t *testing.T) {
+	private := CategorySet(CategoryPrivate, CategoryULA)
+	require.Equal(t, []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}, prefixStrings(private.Prefixes()))
+
+	// the anycast blocks of 192.0.0.0/24 are carved out of it
+	reserved := CategorySet(CategoryReserved)
+	require.True(t, reserved.Contains(netip.MustParseAddr("192.0.0.8")))
+	require.True(t, reserved.ContainsPrefix(netip.MustParsePrefix("192.0.0.0/24")))
+	require.False(t, reserved.Contains(netip.MustParseAddr("192.88.99.1")))
+	require.True(t, reserved.Contains(netip.MustParseAddr("4000::1")))
+	require.False(t, reserved.Contains(netip.MustParseAddr("2001:db8::1")))
+
+	public := CategorySet(CategoryGlobalUnicast)
+	require.True(t, public.Contains(netip.MustParseAddr("8.8.8.8")))
+	require.False(t, public.Contains(netip.MustParseAddr("10.0.0.1")))
+	require.False(t, public.Contains(netip.MustParseAddr("2001:db8::1")))
+	require.True(t, public.Contains(netip.MustParseAddr("2606:4700::1111")))
+	require.True(t, public.Union(CategorySet(CategoryReserved, CategoryPrivate, CategoryCGNAT, CategoryLoopback, CategoryLinkLocal, CategoryMulticast, CategoryDocumentation, CategoryBenchmarking, CategoryULA, Category6to4, CategoryTeredo)).Equal(IPSet{}.Complement()))
+
+	// IPv4-mapped addresses are in the sets of their IPv4 addresses
+	require.True(t, private.Contains(netip.MustParseAddr("::ffff:10.0.0.1")))
+	require.True(t, public.Contains(netip.MustParseAddr("::ffff:8.8.8.8")))
+	require.False(t, reserved.Contains(netip.MustParseAddr("::ffff:8.8.8.8")))
+
+	bogons := SpecialPurposeSet(func(block SpecialPurposeBlock) bool { return !block.GloballyReachable })
+	require.True(t, bogons.Contains(netip.MustParseAddr("192.0.0.8")))
+	require.False(t, bogons.Contains(netip.MustParseAddr("192.0.0.9")))
+	require.False(t, bogons.Contains(netip.MustParseAddr("1.1.1.1")))
+}
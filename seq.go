@@ -0,0 +1,37 @@
+package mapcidr
+
+import (
+	"context"
+	"iter"
+)
+
+// SeqWithContext returns an iterator yielding the values of seq until ctx is
+// done. Breaking out of the loop or cancelling ctx stops seq as well.
+func SeqWithContext[T any](ctx context.Context, seq iter.Seq[T]) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		done := ctx.Done()
+		for v := range seq {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// seqToChan feeds the values of seq to a channel from a goroutine, for the
+// channel based APIs. The goroutine only ends once the channel is drained.
+func seqToChan[T any](seq iter.Seq[T]) chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for v := range seq {
+			out <- v
+		}
+	}()
+	return out
+}
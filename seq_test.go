@@ -0,0 +1,49 @@
+package mapcidr
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAddressesSeq(t *testing.T) {
+	_, ipnet, _ := net.ParseCIDR("192.168.0.0/30")
+	require.Equal(t, []string{"192.168.0.0", "192.168.0.1", "192.168.0.2", "192.168.0.3"}, slices.Collect(IPAddressesSeq(ipnet)))
+
+	// breaking early out of a huge prefix returns right away
+	_, ipnet, _ = net.ParseCIDR("2001:db8::/32")
+	var got []string
+	for ip := range IPAddressesSeq(ipnet) {
+		got = append(got, ip)
+		if len(got) == 2 {
+			break
+		}
+	}
+	require.Equal(t, []string{"2001:db8::", "2001:db8::1"}, got)
+
+	require.Equal(t, []netip.Addr{netip.MustParseAddr("255.255.255.255")}, slices.Collect(PrefixAddrsSeq(netip.MustParsePrefix("255.255.255.255/32"))))
+}
+
+func TestSeqWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/8")
+	count := 0
+	for range IPAddressesSeqContext(ctx, ipnet) {
+		count++
+		if count == 10 {
+			cancel()
+		}
+	}
+	require.Equal(t, 10, count)
+
+	count = 0
+	for range ShuffleCidrsSeqContext(ctx, []*net.IPNet{ipnet}, 1) {
+		count++
+	}
+	require.Zero(t, count)
+}
@@ -1,68 +1,106 @@
 package mapcidr
 
 import (
+	"context"
+	"iter"
 	"net"
-
-	"github.com/projectdiscovery/blackrock"
+	"net/netip"
 )
 
-// ShuffleCidrsWithSeed uses blackrock to visit all ips in random order
+// ShuffleCidrsWithSeed visits all ips, IPv4 and IPv6, in random order
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use ShuffleCidrsSeq instead.
 func ShuffleCidrsWithSeed(cidrs []*net.IPNet, seed int64) chan Item {
-	// Shrink and compact
-	cidrs, _ = CoalesceCIDRs(cidrs)
-	out := make(chan Item)
-	go func(out chan Item, cidrs []*net.IPNet) {
-		defer close(out)
-		targetsCount := int64(TotalIPSInCidrs(cidrs))
-		Range := targetsCount
-		br := blackrock.New(Range, seed)
-		for index := int64(0); index < Range; index++ {
-			ipIndex := br.Shuffle(index)
-			ip := PickIP(cidrs, ipIndex)
-			if ip == "" {
-				continue
-			}
-			out <- Item{IP: ip}
-		}
-	}(out, cidrs)
-	return out
+	return seqToChan(ShuffleCidrsSeq(cidrs, seed))
 }
 
-// ShuffleCidrsWithPortsAndSeed uses blackrock to visit all ips and ports combinations in random order
+// ShuffleCidrsWithPortsAndSeed visits all ips, IPv4 and IPv6, and ports combinations in random order
+//
+// Deprecated: the channel is fed by a goroutine which leaks if the consumer
+// stops reading early; use ShuffleCidrsWithPortsSeq instead.
 func ShuffleCidrsWithPortsAndSeed(cidrs []*net.IPNet, ports []int, seed int64) chan Item {
-	// Shrink and compact
-	cidrs, _ = CoalesceCIDRs(cidrs)
-	out := make(chan Item)
-	go func(out chan Item, cidrs []*net.IPNet) {
-		defer close(out)
-		targetsCount := int64(TotalIPSInCidrs(cidrs))
-		portsCount := int64(len(ports))
-		Range := targetsCount * portsCount
-		br := blackrock.New(Range, seed)
-		for index := int64(0); index < Range; index++ {
-			xxx := br.Shuffle(index)
-			ipIndex := xxx / portsCount
-			portIndex := int(xxx % portsCount)
-			ip := PickIP(cidrs, ipIndex)
-			port := PickPort(ports, portIndex)
+	return seqToChan(ShuffleCidrsWithPortsSeq(cidrs, ports, seed))
+}
+
+// ShuffleCidrsSeq returns an iterator visiting all ips, IPv4 and IPv6, in random order
+func ShuffleCidrsSeq(cidrs []*net.IPNet, seed int64) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		shufflePrefixes(prefixesFromIPNets(cidrs), seed, func(addr netip.Addr) bool {
+			return yield(Item{IP: addr.String()})
+		})
+	}
+}
+
+// ShuffleCidrsSeqContext is like ShuffleCidrsSeq but also stops when ctx is done
+func ShuffleCidrsSeqContext(ctx context.Context, cidrs []*net.IPNet, seed int64) iter.Seq[Item] {
+	return SeqWithContext(ctx, ShuffleCidrsSeq(cidrs, seed))
+}
+
+// ShuffleCidrsWithPortsSeq returns an iterator visiting all ips, IPv4 and IPv6, and ports combinations in random order
+func ShuffleCidrsWithPortsSeq(cidrs []*net.IPNet, ports []int, seed int64) iter.Seq[Item] {
+	return func(yield func(Item) bool) {
+		shufflePrefixesWithPorts(prefixesFromIPNets(cidrs), ports, seed, func(addrPort netip.AddrPort) bool {
+			return yield(Item{IP: addrPort.Addr().String(), Port: int(addrPort.Port())})
+		})
+	}
+}
+
+// ShuffleCidrsWithPortsSeqContext is like ShuffleCidrsWithPortsSeq but also stops when ctx is done
+func ShuffleCidrsWithPortsSeqContext(ctx context.Context, cidrs []*net.IPNet, ports []int, seed int64) iter.Seq[Item] {
+	return SeqWithContext(ctx, ShuffleCidrsWithPortsSeq(cidrs, ports, seed))
+}
 
-			if ip == "" || port <= 0 {
-				continue
+// ShuffleCidrsExcludingSeq returns an iterator visiting all ips, IPv4 and
+// IPv6, or all ips and ports combinations if ports isn't empty, in random
+// order, never visiting the excluded targets. The exclusions are applied
+// during the walk, without expanding them.
+func ShuffleCidrsExcludingSeq(cidrs []*net.IPNet, ports []int, seed int64, exclude Exclusions) (iter.Seq[Item], error) {
+	portSet, err := PortSetFromPorts(ports)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewShuffler(prefixesFromIPNets(cidrs), portSet, ShuffleOptions{Seed: seed, Exclude: exclude})
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(Item) bool) {
+		for target := range s.All() {
+			item := Item{IP: target.Addr().String(), Port: int(target.Port())}
+			if !yield(item) {
+				return
 			}
-			out <- Item{IP: ip, Port: port}
 		}
-	}(out, cidrs)
-	return out
+	}, nil
+}
+
+// ShuffleTargetsSeq returns an iterator visiting all the ips and ports
+// combinations of the targets, each with its own ports, in random order.
+// The order is uniform across all the targets. Targets without ports yield
+// their bare ips.
+func ShuffleTargetsSeq(targets []Target, seed int64) (iter.Seq[Item], error) {
+	s, err := NewTargetShuffler(targets, ShuffleOptions{Seed: seed})
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(Item) bool) {
+		for target := range s.All() {
+			if !yield(Item{IP: target.Addr().String(), Port: int(target.Port())}) {
+				return
+			}
+		}
+	}, nil
 }
 
 // PickIP takes an ip from a list of subnets
 func PickIP(cidrs []*net.IPNet, index int64) string {
 	for _, target := range cidrs {
-		subnetIpsCount := int64(AddressCountIpnet(target))
-		if index < subnetIpsCount {
+		prefixLen, bits := target.Mask.Size()
+		// an int64 index always falls within subnets of 2^63 addresses or more
+		if hostBits := bits - prefixLen; hostBits >= 63 || index < 1<<hostBits {
 			return PickSubnetIP(target, index)
 		}
-		index -= subnetIpsCount
+		index -= 1 << (bits - prefixLen)
 	}
 
 	return ""
@@ -70,7 +108,12 @@ func PickIP(cidrs []*net.IPNet, index int64) string {
 
 // PickSubnetIP takes an ip from a subnet
 func PickSubnetIP(network *net.IPNet, index int64) string {
-	return Inet_ntoa(Inet_aton(network.IP) + index).String()
+	prefix, ok := PrefixFromIPNet(network)
+	if !ok {
+		return ""
+	}
+	first, _ := prefixRange(prefix)
+	return first.add(uint128{0, uint64(index)}).addr(prefix.Addr().Is4()).String()
 }
 
 // PickPort takes a port from a list
@@ -85,3 +128,15 @@ func CIDRsAsIPNET(cidrs []string) (ipnets []*net.IPNet) {
 	}
 	return
 }
+
+// prefixesFromIPNets converts the valid networks to prefixes, skipping the
+// invalid ones.
+func prefixesFromIPNets(networks []*net.IPNet) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		if prefix, ok := PrefixFromIPNet(network); ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
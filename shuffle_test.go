@@ -0,0 +1,90 @@
+package mapcidr
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/projectdiscovery/blackrock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShuffleCidrsWithSeedIPv6(t *testing.T) {
+	var cidrs []*net.IPNet
+	for _, cidr := range []string{"2001:db8::/126", "10.0.0.0/31", "2001:db8::2/127"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		cidrs = append(cidrs, network)
+	}
+
+	var got []string
+	for item := range ShuffleCidrsWithSeed(cidrs, 1) {
+		got = append(got, item.IP)
+	}
+	require.ElementsMatch(t, []string{"10.0.0.0", "10.0.0.1", "2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}, got)
+
+	var gotItems []string
+	for item := range ShuffleCidrsWithPortsAndSeed(cidrs[:1], []int{80, 443}, 1) {
+		gotItems = append(gotItems, item.String())
+	}
+	require.ElementsMatch(t, []string{
+		"[2001:db8::]:80", "[2001:db8::1]:80", "[2001:db8::2]:80", "[2001:db8::3]:80",
+		"[2001:db8::]:443", "[2001:db8::1]:443", "[2001:db8::2]:443", "[2001:db8::3]:443",
+	}, gotItems)
+}
+
+func TestShuffleCidrsWithPortsOrder(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/30")
+	ports := []int{443, 80, 8080}
+
+	// the sequence is the one of the blackrock permutation over the
+	// ip and port combinations, the ports being picked in the given order
+	br := blackrock.New(12, 5)
+	var want []string
+	for i := int64(0); i < 12; i++ {
+		x := br.Shuffle(i)
+		want = append(want, Item{IP: PickSubnetIP(network, x/3), Port: ports[x%3]}.String())
+	}
+	var got []string
+	for item := range ShuffleCidrsWithPortsAndSeed([]*net.IPNet{network}, ports, 5) {
+		got = append(got, item.String())
+	}
+	require.Equal(t, want, got)
+}
+
+func TestShufflePrefixesBeyondInt64(t *testing.T) {
+	prefix := netip.MustParsePrefix("2001:db8::/48")
+	seen := make(map[netip.Addr]struct{})
+	for addr := range ShufflePrefixesWithSeed([]netip.Prefix{prefix}, 7) {
+		require.True(t, prefix.Contains(addr))
+		seen[addr] = struct{}{}
+		if len(seen) == 1000 {
+			break
+		}
+	}
+	require.Len(t, seen, 1000)
+}
+
+func TestFeistelPermutation(t *testing.T) {
+	for _, size := range []uint64{1, 2, 3, 1000, 4096} {
+		p := newFeistelPermutation(uint128{0, size}, 42)
+		seen := make(map[uint64]struct{})
+		for i := uint64(0); i < size; i++ {
+			v := p.shuffle(uint128{0, i})
+			require.Zero(t, v.hi)
+			require.Less(t, v.lo, size)
+			seen[v.lo] = struct{}{}
+		}
+		require.Len(t, seen, int(size))
+	}
+
+	// the same seed gives the same order
+	a, b := newFeistelPermutation(max128, 3), newFeistelPermutation(max128, 3)
+	require.Equal(t, a.shuffle(uint128{1, 2}), b.shuffle(uint128{1, 2}))
+}
+
+func TestPickSubnetIPv6(t *testing.T) {
+	_, network, _ := net.ParseCIDR("2001:db8::/64")
+	require.Equal(t, "2001:db8::ff", PickSubnetIP(network, 255))
+	_, network, _ = net.ParseCIDR("10.0.0.0/24")
+	require.Equal(t, "10.0.0.10", PickSubnetIP(network, 10))
+}
@@ -0,0 +1,271 @@
+package mapcidr
+
+import (
+	"fmt"
+	"iter"
+	"math/big"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// ShuffleOptions configures the enumeration of a Shuffler.
+type ShuffleOptions struct {
+	// Seed selects the visiting order: the same seed always gives the same
+	// order for the same targets.
+	Seed int64
+	// StartIndex skips the first targets of the order, e.g. to resume from
+	// the Index of a Checkpoint. Nil starts from the beginning.
+	StartIndex *big.Int
+	// Shards splits the order between workers: with the same seed and
+	// targets, the shard Shard (from 0 to Shards-1) visits the positions
+	// of the order whose remainder modulo Shards is Shard, so that the
+	// shards are disjoint and together visit every target. Zero disables
+	// sharding.
+	Shard, Shards int
+	// Exclude lists the targets never to visit
+	Exclude Exclusions
+}
+
+// Exclusions lists the targets a Shuffler must never visit.
+type Exclusions struct {
+	// Addrs are excluded with all their ports
+	Addrs IPSet
+	// AddrPorts are only excluded for the given port
+	AddrPorts []netip.AddrPort
+}
+
+// ParseExclusions parses a list of IPs, CIDRs, IPv4 CIDRs with a netmask or
+// wildcard mask as accepted by ParseMaskPrefix, ranges as accepted by
+// ParseRange, and ip:port pairs such as "10.0.0.1:80" or "[2001:db8::1]:443".
+func ParseExclusions(items []string) (Exclusions, error) {
+	var (
+		exclusions Exclusions
+		ranges     []IPRange
+	)
+	for _, item := range items {
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			ranges = append(ranges, PrefixRange(prefix))
+		} else if prefix, err := ParseMaskPrefix(item); err == nil {
+			ranges = append(ranges, PrefixRange(prefix))
+		} else if addr, err := netip.ParseAddr(item); err == nil {
+			addr = addr.Unmap().WithZone("")
+			ranges = append(ranges, IPRange{First: addr, Last: addr})
+		} else if addrPort, err := netip.ParseAddrPort(item); err == nil {
+			exclusions.AddrPorts = append(exclusions.AddrPorts, netip.AddrPortFrom(addrPort.Addr().Unmap().WithZone(""), addrPort.Port()))
+		} else if r, err := ParseRange(item); err == nil {
+			ranges = append(ranges, r)
+		} else {
+			return Exclusions{}, fmt.Errorf("invalid exclusion %q: expected an IP, a CIDR, a range or an ip:port", item)
+		}
+	}
+	exclusions.Addrs = IPSetFromRanges(ranges)
+	return exclusions, nil
+}
+
+// Checkpoint is the serializable progress of a Shuffler. Creating a Shuffler
+// for the same targets with its Seed, shard and Index as StartIndex continues
+// the enumeration where it stopped.
+type Checkpoint struct {
+	Seed int64 `json:"seed"`
+	// Index is the position of the next target to visit in the order
+	Index *big.Int `json:"index"`
+	// Total is the number of targets, to detect resuming with other targets
+	Total  *big.Int `json:"total"`
+	Shard  int      `json:"shard,omitempty"`
+	Shards int      `json:"shards,omitempty"`
+}
+
+// Shuffler visits all the IPv4 and IPv6 addresses of a set of targets, or
+// all their address and port combinations, in a random order which can be
+// stopped and resumed. A Shuffler is not safe for concurrent use.
+type Shuffler struct {
+	// segments split the order indexes between the groups of addresses
+	// sharing the same ports
+	segments []shuffleSegment
+	// excluded holds the excluded ip:port pairs, the excluded addresses
+	// being removed from the segments up front
+	excluded map[netip.AddrPort]struct{}
+	seed     int64
+	shard    int
+	shards   int
+	size     uint128
+	perm     permutation
+	// next is the position of the next target in the order
+	next uint128
+}
+
+type shuffleSegment struct {
+	space addrSpace
+	ports PortSet
+	// offset is the index of the first target of the segment
+	offset uint128
+}
+
+// NewShuffler returns a Shuffler over the addresses of the prefixes, combined
+// with each port if ports isn't empty. The ports are never expanded, so
+// large port sets cost nothing more than a few ones.
+func NewShuffler(prefixes []netip.Prefix, ports PortSet, opts ShuffleOptions) (*Shuffler, error) {
+	targets := make([]Target, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		if prefix.IsValid() {
+			targets = append(targets, Target{Prefix: prefix, Ports: ports})
+		}
+	}
+	return NewTargetShuffler(targets, opts)
+}
+
+// NewTargetShuffler returns a Shuffler over the targets, each with its own
+// ports. The order is uniform over the whole (address, port) space, and a
+// combination listed by several targets is only visited once.
+func NewTargetShuffler(targets []Target, opts ShuffleOptions) (*Shuffler, error) {
+	if opts.Shards < 0 || opts.Shard < 0 || opts.Shard >= max(opts.Shards, 1) {
+		return nil, fmt.Errorf("invalid shard %d of %d", opts.Shard, opts.Shards)
+	}
+
+	s := &Shuffler{
+		seed:   opts.Seed,
+		shard:  opts.Shard,
+		shards: opts.Shards,
+	}
+	hasPorts := false
+	for _, group := range targetGroups(targets) {
+		// Shrink and compact
+		space := newAddrSpace(group.addrs.Difference(opts.Exclude.Addrs).ranges)
+		if space.size.isZero() {
+			continue
+		}
+		size := space.size
+		if group.ports.Len() > 0 {
+			hasPorts = true
+			var overflow bool
+			if size, overflow = size.mul64(uint64(group.ports.Len())); overflow {
+				size = max128
+			}
+		}
+		s.segments = append(s.segments, shuffleSegment{space: space, ports: group.ports, offset: s.size})
+		var overflow bool
+		if s.size, overflow = s.size.addOverflow(size); overflow {
+			// the targets past the maximum index are dropped
+			s.size = max128
+			break
+		}
+	}
+	if opts.StartIndex != nil {
+		start, ok := u128FromBig(opts.StartIndex)
+		if !ok || start.cmp(s.size) > 0 {
+			return nil, fmt.Errorf("start index %s out of range [0, %s]", opts.StartIndex, s.size.big())
+		}
+		s.next = start
+	}
+	if s.shards > 1 {
+		// move to the first position of the shard
+		_, remainder := s.next.divMod64(uint64(s.shards))
+		s.advance((uint64(s.shard) + uint64(s.shards) - remainder) % uint64(s.shards))
+	}
+	if hasPorts && len(opts.Exclude.AddrPorts) > 0 {
+		s.excluded = make(map[netip.AddrPort]struct{}, len(opts.Exclude.AddrPorts))
+		for _, addrPort := range opts.Exclude.AddrPorts {
+			s.excluded[addrPort] = struct{}{}
+		}
+	}
+	s.perm = newPermutation(s.size, opts.Seed)
+	return s, nil
+}
+
+// advance moves the position forward by n, stopping at the end of the order.
+func (s *Shuffler) advance(n uint64) {
+	next, overflow := s.next.addOverflow(uint128{0, n})
+	if overflow || next.cmp(s.size) > 0 {
+		next = s.size
+	}
+	s.next = next
+}
+
+// Total returns the number of targets of the enumeration.
+func (s *Shuffler) Total() *big.Int {
+	return s.size.big()
+}
+
+// Checkpoint returns the current progress of the enumeration.
+func (s *Shuffler) Checkpoint() Checkpoint {
+	return Checkpoint{Seed: s.seed, Index: s.next.big(), Total: s.size.big(), Shard: s.shard, Shards: s.shards}
+}
+
+// All returns an iterator over the targets left, in random order, skipping
+// the excluded ones. The port is zero for the targets without ports. A
+// target counts as visited as soon as it is yielded, so a checkpoint taken
+// while handling it resumes after it. Consumers handing the targets over to
+// a writer should only save the checkpoints of the targets written out.
+func (s *Shuffler) All() iter.Seq[netip.AddrPort] {
+	return func(yield func(netip.AddrPort) bool) {
+		step := uint64(max(s.shards, 1))
+		for s.next.cmp(s.size) < 0 {
+			target := s.at(s.perm.shuffle(s.next))
+			s.advance(step)
+
+			if s.excluded != nil {
+				if _, ok := s.excluded[target]; ok {
+					continue
+				}
+			}
+			if !yield(target) {
+				return
+			}
+		}
+	}
+}
+
+// at returns the target at index, which must be less than the size.
+func (s *Shuffler) at(index uint128) netip.AddrPort {
+	i := sort.Search(len(s.segments), func(i int) bool {
+		return s.segments[i].offset.cmp(index) > 0
+	}) - 1
+	segment := s.segments[i]
+	if segment.ports.Len() == 0 {
+		return netip.AddrPortFrom(segment.space.at(index.sub(segment.offset)), 0)
+	}
+	ipIndex, portIndex := index.sub(segment.offset).divMod64(uint64(segment.ports.Len()))
+	return netip.AddrPortFrom(segment.space.at(ipIndex), uint16(segment.ports.At(int(portIndex))))
+}
+
+func shufflePrefixes(prefixes []netip.Prefix, seed int64, yield func(netip.Addr) bool) {
+	s, _ := NewShuffler(prefixes, PortSet{}, ShuffleOptions{Seed: seed})
+	for target := range s.All() {
+		if !yield(target.Addr()) {
+			return
+		}
+	}
+}
+
+func shufflePrefixesWithPorts(prefixes []netip.Prefix, ports []int, seed int64, yield func(netip.AddrPort) bool) {
+	// invalid ports are skipped
+	validPorts := make([]int, 0, len(ports))
+	for _, port := range ports {
+		if port > 0 && port <= 65535 {
+			validPorts = append(validPorts, port)
+		}
+	}
+	if len(validPorts) == 0 {
+		return
+	}
+	portSet, _ := PortSetFromPorts(validPorts)
+	// the set sorts the ports, which are picked back in the given order, as
+	// before port sets, so that a seed keeps giving the same sequence
+	ordered := make([]int, 0, portSet.Len())
+	seen := make(map[int]struct{}, portSet.Len())
+	for _, port := range validPorts {
+		if _, ok := seen[port]; !ok {
+			seen[port] = struct{}{}
+			ordered = append(ordered, port)
+		}
+	}
+	sorted := slices.Collect(portSet.All())
+	s, _ := NewShuffler(prefixes, portSet, ShuffleOptions{Seed: seed})
+	for target := range s.All() {
+		i, _ := slices.BinarySearch(sorted, int(target.Port()))
+		if !yield(netip.AddrPortFrom(target.Addr(), uint16(ordered[i]))) {
+			return
+		}
+	}
+}
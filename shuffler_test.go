@@ -0,0 +1,168 @@
+package mapcidr
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShufflerResume(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/28"), netip.MustParsePrefix("2001:db8::/126")}
+	ports := mustParsePorts(t, "80,443")
+
+	s, err := NewShuffler(prefixes, ports, ShuffleOptions{Seed: 7})
+	require.NoError(t, err)
+	require.Equal(t, big.NewInt(40), s.Total())
+	var full []netip.AddrPort
+	for target := range s.All() {
+		full = append(full, target)
+	}
+	require.Len(t, full, 40)
+	unique := make(map[netip.AddrPort]struct{})
+	for _, target := range full {
+		unique[target] = struct{}{}
+	}
+	require.Len(t, unique, 40)
+
+	// stop after 15 targets and resume from the serialized checkpoint
+	s, err = NewShuffler(prefixes, ports, ShuffleOptions{Seed: 7})
+	require.NoError(t, err)
+	var got []netip.AddrPort
+	for target := range s.All() {
+		got = append(got, target)
+		if len(got) == 15 {
+			break
+		}
+	}
+	data, err := json.Marshal(s.Checkpoint())
+	require.NoError(t, err)
+	require.JSONEq(t, `{"seed":7,"index":15,"total":40}`, string(data))
+
+	var checkpoint Checkpoint
+	require.NoError(t, json.Unmarshal(data, &checkpoint))
+	s, err = NewShuffler(prefixes, ports, ShuffleOptions{Seed: checkpoint.Seed, StartIndex: checkpoint.Index})
+	require.NoError(t, err)
+	for target := range s.All() {
+		got = append(got, target)
+	}
+	require.Equal(t, full, got)
+}
+
+func TestNewShufflerErrors(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/30")}
+	_, err := NewShuffler(prefixes, PortSet{}, ShuffleOptions{StartIndex: big.NewInt(5)})
+	require.Error(t, err)
+	_, err = NewShuffler(prefixes, PortSet{}, ShuffleOptions{StartIndex: big.NewInt(-1)})
+	require.Error(t, err)
+
+	// a shuffler without ports yields zero ports
+	s, err := NewShuffler(prefixes, PortSet{}, ShuffleOptions{StartIndex: big.NewInt(3)})
+	require.NoError(t, err)
+	for target := range s.All() {
+		require.Zero(t, target.Port())
+	}
+}
+
+func TestShufflerShards(t *testing.T) {
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/27"), netip.MustParsePrefix("2001:db8::/125")}
+	for _, ports := range []PortSet{{}, mustParsePorts(t, "ssh,http,https")} {
+		s, err := NewShuffler(prefixes, ports, ShuffleOptions{Seed: 3})
+		require.NoError(t, err)
+		var full []netip.AddrPort
+		for target := range s.All() {
+			full = append(full, target)
+		}
+
+		for _, shards := range []int{1, 2, 3, 7, 100} {
+			seen := make(map[netip.AddrPort]int)
+			for shard := 0; shard < shards; shard++ {
+				s, err := NewShuffler(prefixes, ports, ShuffleOptions{Seed: 3, Shard: shard, Shards: shards})
+				require.NoError(t, err)
+				position := shard
+				for target := range s.All() {
+					// each shard walks its own slice of the same permutation
+					require.Equal(t, full[position], target)
+					position += shards
+					seen[target]++
+				}
+			}
+			// the shards are disjoint and exhaustive
+			require.Len(t, seen, len(full))
+			for _, count := range seen {
+				require.Equal(t, 1, count)
+			}
+		}
+	}
+
+	// resuming a shard continues on the same shard
+	s, err := NewShuffler(prefixes, PortSet{}, ShuffleOptions{Seed: 3, Shard: 1, Shards: 4})
+	require.NoError(t, err)
+	var got []netip.AddrPort
+	for target := range s.All() {
+		got = append(got, target)
+		if len(got) == 3 {
+			break
+		}
+	}
+	checkpoint := s.Checkpoint()
+	require.Equal(t, int64(13), checkpoint.Index.Int64())
+	s, err = NewShuffler(prefixes, PortSet{}, ShuffleOptions{Seed: 3, Shard: 1, Shards: 4, StartIndex: checkpoint.Index})
+	require.NoError(t, err)
+	for target := range s.All() {
+		got = append(got, target)
+	}
+	require.Len(t, got, 10)
+
+	for _, opts := range []ShuffleOptions{{Shard: 2, Shards: 2}, {Shard: -1, Shards: 2}, {Shard: 1}, {Shards: -1}} {
+		_, err := NewShuffler(prefixes, PortSet{}, opts)
+		require.Error(t, err)
+	}
+}
+
+func TestShufflerExclusions(t *testing.T) {
+	exclude, err := ParseExclusions([]string{"10.0.0.0/30", "10.0.0.9", "10.0.0.12-10.0.0.13", "10.0.0.5:443", "[2001:db8::1]:80", "2001:db8::2"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/30", "10.0.0.9/32", "10.0.0.12/31", "2001:db8::2/128"}, prefixStrings(exclude.Addrs.Prefixes()))
+	require.Len(t, exclude.AddrPorts, 2)
+
+	masked, err := ParseExclusions([]string{"10.0.0.0/255.255.255.252", "10.0.0.8 0.0.0.1"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/30", "10.0.0.8/31"}, prefixStrings(masked.Addrs.Prefixes()))
+
+	_, err = ParseExclusions([]string{"example.com"})
+	require.Error(t, err)
+	_, err = ParseExclusions([]string{"10.0.0.0/255.0.255.0"})
+	require.Error(t, err)
+
+	prefixes := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/28"), netip.MustParsePrefix("2001:db8::/126")}
+	for _, shards := range []int{0, 3} {
+		var got []string
+		for shard := 0; shard < max(shards, 1); shard++ {
+			s, err := NewShuffler(prefixes, mustParsePorts(t, "80,443"), ShuffleOptions{Seed: 9, Exclude: exclude, Shard: shard, Shards: shards})
+			require.NoError(t, err)
+			for target := range s.All() {
+				got = append(got, target.String())
+			}
+		}
+		require.Len(t, got, 2*(16-7)-1+2*(4-1)-1)
+		require.NotContains(t, got, "10.0.0.2:80")
+		require.NotContains(t, got, "10.0.0.9:443")
+		require.NotContains(t, got, "10.0.0.5:443")
+		require.Contains(t, got, "10.0.0.5:80")
+		require.NotContains(t, got, "[2001:db8::1]:80")
+		require.Contains(t, got, "[2001:db8::1]:443")
+		require.NotContains(t, got, "[2001:db8::2]:443")
+	}
+
+	// ip:port exclusions don't apply without ports
+	s, err := NewShuffler(prefixes, PortSet{}, ShuffleOptions{Seed: 9, Exclude: exclude})
+	require.NoError(t, err)
+	count := 0
+	for range s.All() {
+		count++
+	}
+	require.Equal(t, 16-7+4-1, count)
+}
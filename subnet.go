@@ -0,0 +1,73 @@
+package mapcidr
+
+import (
+	"fmt"
+	"iter"
+	"net/netip"
+)
+
+// ParentPrefix returns the prefix of length bits containing prefix, e.g.
+// 10.0.0.0/16 for 10.0.3.0/24 and 16 bits.
+func ParentPrefix(prefix netip.Prefix, bits int) (netip.Prefix, error) {
+	if !prefix.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	if bits < 0 || bits > prefix.Bits() {
+		return netip.Prefix{}, fmt.Errorf("cannot get the /%d parent of %s", bits, prefix)
+	}
+	return netip.PrefixFrom(prefix.Addr(), bits).Masked(), nil
+}
+
+// ChildPrefixes returns an iterator over the subnets of length bits of the
+// prefix, in order. It's the same as SplitPrefixByLengthSeq.
+func ChildPrefixes(prefix netip.Prefix, bits int) (iter.Seq[netip.Prefix], error) {
+	return SplitPrefixByLengthSeq(prefix, bits)
+}
+
+// SiblingPrefix returns the other half of the parent of prefix, e.g.
+// 10.0.1.0/24 for 10.0.0.0/24. A /0 prefix has no sibling.
+func SiblingPrefix(prefix netip.Prefix) (netip.Prefix, error) {
+	if !prefix.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	if prefix.Bits() == 0 {
+		return netip.Prefix{}, fmt.Errorf("%s has no sibling", prefix)
+	}
+	is4 := prefix.Addr().Is4()
+	first, _ := prefixRange(prefix)
+	bit := one128.lsh(uint(prefix.Addr().BitLen() - prefix.Bits()))
+	return netip.PrefixFrom(first.xor(bit).addr(is4), prefix.Bits()), nil
+}
+
+// NextPrefix returns the prefix of the same length following prefix, e.g.
+// 10.0.1.0/24 for 10.0.0.0/24. It fails at the end of the address space.
+func NextPrefix(prefix netip.Prefix) (netip.Prefix, error) {
+	if !prefix.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	_, last := prefixRange(prefix)
+	if last == hostMask(prefix.Addr().BitLen()) {
+		return netip.Prefix{}, fmt.Errorf("%s is the last /%d subnet", prefix.Masked(), prefix.Bits())
+	}
+	return netip.PrefixFrom(last.addOne().addr(prefix.Addr().Is4()), prefix.Bits()), nil
+}
+
+// PreviousPrefix returns the prefix of the same length preceding prefix,
+// e.g. 10.0.0.0/24 for 10.0.1.0/24. It fails at the start of the address
+// space.
+func PreviousPrefix(prefix netip.Prefix) (netip.Prefix, error) {
+	if !prefix.IsValid() {
+		return netip.Prefix{}, fmt.Errorf("invalid prefix %s", prefix)
+	}
+	first, _ := prefixRange(prefix)
+	if first.isZero() {
+		return netip.Prefix{}, fmt.Errorf("%s is the first /%d subnet", prefix.Masked(), prefix.Bits())
+	}
+	return netip.PrefixFrom(first.subOne().addr(prefix.Addr().Is4()), prefix.Bits()).Masked(), nil
+}
+
+// IsAlignedPrefix reports whether the address of the prefix is its network
+// address, e.g. true for 10.0.0.0/24 but false for 10.0.0.1/24.
+func IsAlignedPrefix(prefix netip.Prefix) bool {
+	return prefix.IsValid() && prefix.Addr() == prefix.Masked().Addr()
+}
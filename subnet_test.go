@@ -0,0 +1,95 @@
+package mapcidr
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParentPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		cidr     string
+		bits     int
+		expected string
+	}{
+		{"10.0.3.0/24", 16, "10.0.0.0/16"},
+		{"10.0.3.0/24", 24, "10.0.3.0/24"},
+		{"10.0.3.7/24", 22, "10.0.0.0/22"},
+		{"192.168.1.1/32", 0, "0.0.0.0/0"},
+		{"2001:db8:1:2::/64", 32, "2001:db8::/32"},
+	} {
+		parent, err := ParentPrefix(netip.MustParsePrefix(tt.cidr), tt.bits)
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, parent.String())
+	}
+
+	_, err := ParentPrefix(netip.MustParsePrefix("10.0.0.0/16"), 24)
+	require.Error(t, err)
+	_, err = ParentPrefix(netip.MustParsePrefix("10.0.0.0/16"), -1)
+	require.Error(t, err)
+}
+
+func TestChildPrefixes(t *testing.T) {
+	children, err := ChildPrefixes(netip.MustParsePrefix("10.0.0.0/24"), 26)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/26", "10.0.0.192/26"}, prefixStrings(slices.Collect(children)))
+
+	_, err = ChildPrefixes(netip.MustParsePrefix("10.0.0.0/24"), 16)
+	require.Error(t, err)
+}
+
+func TestSiblingPrefix(t *testing.T) {
+	for _, tt := range []struct{ cidr, expected string }{
+		{"10.0.0.0/24", "10.0.1.0/24"},
+		{"10.0.1.0/24", "10.0.0.0/24"},
+		{"10.0.1.9/24", "10.0.0.0/24"},
+		{"0.0.0.0/1", "128.0.0.0/1"},
+		{"255.255.255.255/32", "255.255.255.254/32"},
+		{"2001:db8::/33", "2001:db8:8000::/33"},
+	} {
+		sibling, err := SiblingPrefix(netip.MustParsePrefix(tt.cidr))
+		require.NoError(t, err)
+		require.Equal(t, tt.expected, sibling.String())
+	}
+
+	_, err := SiblingPrefix(netip.MustParsePrefix("::/0"))
+	require.Error(t, err)
+}
+
+func TestNextPreviousPrefix(t *testing.T) {
+	for _, tt := range []struct{ cidr, next, previous string }{
+		{"10.0.1.0/24", "10.0.2.0/24", "10.0.0.0/24"},
+		{"10.0.255.0/24", "10.1.0.0/24", "10.0.254.0/24"},
+		{"10.0.1.9/24", "10.0.2.0/24", "10.0.0.0/24"},
+		{"192.168.0.1/32", "192.168.0.2/32", "192.168.0.0/32"},
+		{"2001:db8::/64", "2001:db8:0:1::/64", "2001:db7:ffff:ffff::/64"},
+	} {
+		next, err := NextPrefix(netip.MustParsePrefix(tt.cidr))
+		require.NoError(t, err)
+		require.Equal(t, tt.next, next.String())
+
+		previous, err := PreviousPrefix(netip.MustParsePrefix(tt.cidr))
+		require.NoError(t, err)
+		require.Equal(t, tt.previous, previous.String())
+	}
+
+	for _, cidr := range []string{"255.255.255.0/24", "0.0.0.0/0", "ffff::/16"} {
+		_, err := NextPrefix(netip.MustParsePrefix(cidr))
+		require.Error(t, err, cidr)
+	}
+	for _, cidr := range []string{"0.0.0.0/24", "0.0.0.0/0", "::/16"} {
+		_, err := PreviousPrefix(netip.MustParsePrefix(cidr))
+		require.Error(t, err, cidr)
+	}
+}
+
+func TestIsAlignedPrefix(t *testing.T) {
+	require.True(t, IsAlignedPrefix(netip.MustParsePrefix("10.0.0.0/24")))
+	require.True(t, IsAlignedPrefix(netip.MustParsePrefix("10.0.0.1/32")))
+	require.False(t, IsAlignedPrefix(netip.MustParsePrefix("10.0.0.1/24")))
+	require.True(t, IsAlignedPrefix(netip.MustParsePrefix("2001:db8::/32")))
+	require.False(t, IsAlignedPrefix(netip.MustParsePrefix("2001:db8::1/64")))
+	require.False(t, IsAlignedPrefix(netip.Prefix{}))
+}
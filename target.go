@@ -0,0 +1,144 @@
+package mapcidr
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Target is a prefix combined with the ports to visit on each of its
+// addresses. A Target without ports stands for the bare addresses.
+type Target struct {
+	Prefix netip.Prefix
+	Ports  PortSet
+}
+
+// ParseTarget parses an IP or a CIDR optionally followed by a port
+// specification as accepted by ParsePorts, such as "10.0.0.0/24:80,443",
+// "192.168.1.1:1-1024" or "[2001:db8::/64]:https". IPv6 targets with ports
+// must be enclosed in brackets.
+func ParseTarget(s string) (Target, error) {
+	s = strings.TrimSpace(s)
+	host, spec, hasPorts := s, "", false
+	switch {
+	case strings.HasPrefix(s, "["):
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return Target{}, fmt.Errorf("invalid target %q: missing ]", s)
+		}
+		host, spec = s[1:end], s[end+1:]
+		if spec != "" {
+			if spec, hasPorts = strings.CutPrefix(spec, ":"); !hasPorts {
+				return Target{}, fmt.Errorf("invalid target %q: expected a port specification after ]", s)
+			}
+		}
+	case strings.Count(s, ":") == 1:
+		// unbracketed IPv6 targets can't have ports, their last group being
+		// ambiguous
+		host, spec, hasPorts = strings.Cut(s, ":")
+	}
+
+	prefix, err := parseTargetPrefix(host)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid target %q: %w", s, err)
+	}
+	target := Target{Prefix: prefix}
+	if hasPorts {
+		if target.Ports, err = ParsePorts(spec); err != nil {
+			return Target{}, fmt.Errorf("invalid target %q: %w", s, err)
+		}
+	}
+	return target, nil
+}
+
+// parseTargetPrefix parses an IP or a CIDR, IPv4-mapped addresses being
+// unmapped.
+func parseTargetPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if addr := prefix.Addr(); addr.Is4In6() {
+			bits := prefix.Bits() - 96
+			if bits < 0 {
+				return netip.Prefix{}, fmt.Errorf("IPv4-mapped prefix %s is shorter than /96", prefix)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), bits)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// targetGroup is a set of addresses sharing the same ports.
+type targetGroup struct {
+	addrs IPSet
+	ports PortSet
+}
+
+// targetGroups splits the targets into groups of addresses with disjoint
+// (address, port) combinations: an address listed by several targets gets
+// the union of their ports, so that no combination is visited twice. Bare
+// targets form their own group, in first position.
+func targetGroups(targets []Target) []targetGroup {
+	// targets sharing the same ports are merged first, so that overlaps only
+	// need resolving between distinct port sets, which are usually few
+	var (
+		keys     []string
+		prefixes = make(map[string][]netip.Prefix)
+		ports    = make(map[string]PortSet)
+	)
+	for _, target := range targets {
+		key := target.Ports.String()
+		if _, ok := prefixes[key]; !ok {
+			keys = append(keys, key)
+			ports[key] = target.Ports
+		}
+		prefixes[key] = append(prefixes[key], target.Prefix)
+	}
+
+	var groups, resolved []targetGroup
+	if bare, ok := prefixes[""]; ok {
+		groups = append(groups, targetGroup{addrs: IPSetFromPrefixes(bare)})
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		addrs := IPSetFromPrefixes(prefixes[key])
+		for i, n := 0, len(resolved); i < n; i++ {
+			common := resolved[i].addrs.Intersect(addrs)
+			if common.IsEmpty() {
+				continue
+			}
+			resolved[i].addrs = resolved[i].addrs.Difference(common)
+			resolved = append(resolved, targetGroup{addrs: common, ports: resolved[i].ports.union(ports[key])})
+			addrs = addrs.Difference(common)
+		}
+		if !addrs.IsEmpty() {
+			resolved = append(resolved, targetGroup{addrs: addrs, ports: ports[key]})
+		}
+	}
+
+	// merge back the pieces which ended up with the same ports
+	index := make(map[string]int)
+	for _, group := range resolved {
+		if group.addrs.IsEmpty() {
+			continue
+		}
+		key := group.ports.String()
+		if i, ok := index[key]; ok {
+			groups[i].addrs = groups[i].addrs.Union(group.addrs)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,93 @@
+package mapcidr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		prefix string
+		ports  string
+	}{
+		{target: "10.0.0.0/24", prefix: "10.0.0.0/24"},
+		{target: "10.0.0.1", prefix: "10.0.0.1/32"},
+		{target: "10.0.0.0/24:80,443", prefix: "10.0.0.0/24", ports: "80,443"},
+		{target: "192.168.1.0/24:1-1024", prefix: "192.168.1.0/24", ports: "1-1024"},
+		{target: " 10.0.0.7/24:https ", prefix: "10.0.0.0/24", ports: "443"},
+		{target: "2001:db8::/64", prefix: "2001:db8::/64"},
+		{target: "2001:db8::1", prefix: "2001:db8::1/128"},
+		{target: "[2001:db8::/64]:22,80", prefix: "2001:db8::/64", ports: "22,80"},
+		{target: "[2001:db8::1]:8000-8002", prefix: "2001:db8::1/128", ports: "8000-8002"},
+		{target: "[::ffff:10.0.0.1]:80", prefix: "10.0.0.1/32", ports: "80"},
+		{target: "[2001:db8::1]", prefix: "2001:db8::1/128"},
+	}
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.target)
+		require.NoError(t, err, tt.target)
+		require.Equal(t, tt.prefix, target.Prefix.String(), tt.target)
+		require.Equal(t, tt.ports, target.Ports.String(), tt.target)
+	}
+
+	for _, s := range []string{"", "10.0.0.0/24:", "10.0.0.0/24:0", "10.0.0.0/33:80", "example.com:80", "[2001:db8::1:80", "[2001:db8::1]80", "[10.0.0.0/24]:foo"} {
+		_, err := ParseTarget(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestTargetShuffler(t *testing.T) {
+	var targets []Target
+	for _, s := range []string{"10.0.0.0/30:80,443", "10.0.0.2/31:22,80", "10.0.0.8/31", "10.0.0.9", "[2001:db8::/127]:8000-8002"} {
+		target, err := ParseTarget(s)
+		require.NoError(t, err)
+		targets = append(targets, target)
+	}
+	want := []string{
+		"10.0.0.0:80", "10.0.0.0:443", "10.0.0.1:80", "10.0.0.1:443",
+		// the overlapping targets get the union of their ports, once
+		"10.0.0.2:22", "10.0.0.2:80", "10.0.0.2:443", "10.0.0.3:22", "10.0.0.3:80", "10.0.0.3:443",
+		"10.0.0.8:0", "10.0.0.9:0",
+		"[2001:db8::]:8000", "[2001:db8::]:8001", "[2001:db8::]:8002",
+		"[2001:db8::1]:8000", "[2001:db8::1]:8001", "[2001:db8::1]:8002",
+	}
+
+	s, err := NewTargetShuffler(targets, ShuffleOptions{Seed: 5})
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprint(len(want)), s.Total().String())
+	var got []string
+	for target := range s.All() {
+		got = append(got, target.String())
+	}
+	require.ElementsMatch(t, want, got)
+	require.NotEqual(t, want, got)
+
+	// shards and exclusions apply across the targets
+	exclude, err := ParseExclusions([]string{"10.0.0.3", "10.0.0.0:443", "2001:db8::1"})
+	require.NoError(t, err)
+	var sharded []string
+	for shard := 0; shard < 3; shard++ {
+		s, err := NewTargetShuffler(targets, ShuffleOptions{Seed: 5, Shard: shard, Shards: 3, Exclude: exclude})
+		require.NoError(t, err)
+		for target := range s.All() {
+			sharded = append(sharded, target.String())
+		}
+	}
+	require.ElementsMatch(t, []string{
+		"10.0.0.0:80", "10.0.0.1:80", "10.0.0.1:443",
+		"10.0.0.2:22", "10.0.0.2:80", "10.0.0.2:443",
+		"10.0.0.8:0", "10.0.0.9:0",
+		"[2001:db8::]:8000", "[2001:db8::]:8001", "[2001:db8::]:8002",
+	}, sharded)
+
+	items, err := ShuffleTargetsSeq(targets[:1], 5)
+	require.NoError(t, err)
+	count := 0
+	for item := range items {
+		require.Contains(t, []int{80, 443}, item.Port)
+		count++
+	}
+	require.Equal(t, 8, count)
+}
@@ -0,0 +1,190 @@
+package mapcidr
+
+import (
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+	"net/netip"
+)
+
+// uint128 is an unsigned 128-bit integer used to do address arithmetic
+// without allocating. IPv4 addresses live in the low 32 bits.
+type uint128 struct {
+	hi, lo uint64
+}
+
+var (
+	zero128 = uint128{}
+	one128  = uint128{0, 1}
+	max128  = uint128{^uint64(0), ^uint64(0)}
+)
+
+// u128FromAddr returns the integer value of an address. IPv4-mapped IPv6
+// addresses are treated as IPv6.
+func u128FromAddr(addr netip.Addr) uint128 {
+	if addr.Is4() {
+		a4 := addr.As4()
+		return uint128{0, uint64(binary.BigEndian.Uint32(a4[:]))}
+	}
+	a16 := addr.As16()
+	return uint128{binary.BigEndian.Uint64(a16[:8]), binary.BigEndian.Uint64(a16[8:])}
+}
+
+// addr converts the integer back to an address of the given family.
+func (u uint128) addr(is4 bool) netip.Addr {
+	if is4 {
+		var a4 [4]byte
+		binary.BigEndian.PutUint32(a4[:], uint32(u.lo))
+		return netip.AddrFrom4(a4)
+	}
+	var a16 [16]byte
+	binary.BigEndian.PutUint64(a16[:8], u.hi)
+	binary.BigEndian.PutUint64(a16[8:], u.lo)
+	return netip.AddrFrom16(a16)
+}
+
+func (u uint128) isZero() bool {
+	return u.hi == 0 && u.lo == 0
+}
+
+func (u uint128) cmp(v uint128) int {
+	switch {
+	case u.hi < v.hi:
+		return -1
+	case u.hi > v.hi:
+		return 1
+	case u.lo < v.lo:
+		return -1
+	case u.lo > v.lo:
+		return 1
+	}
+	return 0
+}
+
+func (u uint128) add(v uint128) uint128 {
+	lo, carry := bits.Add64(u.lo, v.lo, 0)
+	hi, _ := bits.Add64(u.hi, v.hi, carry)
+	return uint128{hi, lo}
+}
+
+// addOverflow adds v to u and reports whether the result wrapped around.
+func (u uint128) addOverflow(v uint128) (uint128, bool) {
+	lo, carry := bits.Add64(u.lo, v.lo, 0)
+	hi, carry := bits.Add64(u.hi, v.hi, carry)
+	return uint128{hi, lo}, carry != 0
+}
+
+func (u uint128) sub(v uint128) uint128 {
+	lo, borrow := bits.Sub64(u.lo, v.lo, 0)
+	hi, _ := bits.Sub64(u.hi, v.hi, borrow)
+	return uint128{hi, lo}
+}
+
+func (u uint128) addOne() uint128 {
+	return u.add(one128)
+}
+
+func (u uint128) subOne() uint128 {
+	return u.sub(one128)
+}
+
+func (u uint128) and(v uint128) uint128 {
+	return uint128{u.hi & v.hi, u.lo & v.lo}
+}
+
+func (u uint128) or(v uint128) uint128 {
+	return uint128{u.hi | v.hi, u.lo | v.lo}
+}
+
+func (u uint128) xor(v uint128) uint128 {
+	return uint128{u.hi ^ v.hi, u.lo ^ v.lo}
+}
+
+func (u uint128) not() uint128 {
+	return uint128{^u.hi, ^u.lo}
+}
+
+// bit returns the i-th most significant bit of u.
+func (u uint128) bit(i int) int {
+	return int(u.rsh(uint(127-i)).lo & 1)
+}
+
+func (u uint128) lsh(n uint) uint128 {
+	switch {
+	case n >= 128:
+		return zero128
+	case n >= 64:
+		return uint128{u.lo << (n - 64), 0}
+	}
+	return uint128{u.hi<<n | u.lo>>(64-n), u.lo << n}
+}
+
+func (u uint128) rsh(n uint) uint128 {
+	switch {
+	case n >= 128:
+		return zero128
+	case n >= 64:
+		return uint128{0, u.hi >> (n - 64)}
+	}
+	return uint128{u.hi >> n, u.lo>>n | u.hi<<(64-n)}
+}
+
+// mul64 multiplies u by v and reports whether the result overflowed.
+func (u uint128) mul64(v uint64) (uint128, bool) {
+	hi, lo := bits.Mul64(u.lo, v)
+	phi, plo := bits.Mul64(u.hi, v)
+	hi, carry := bits.Add64(hi, plo, 0)
+	return uint128{hi, lo}, phi != 0 || carry != 0
+}
+
+// divMod64 divides u by v returning the quotient and the remainder.
+func (u uint128) divMod64(v uint64) (uint128, uint64) {
+	qhi, r := bits.Div64(0, u.hi, v)
+	qlo, r := bits.Div64(r, u.lo, v)
+	return uint128{qhi, qlo}, r
+}
+
+// bitLen returns the minimum number of bits required to represent u.
+func (u uint128) bitLen() int {
+	if u.hi != 0 {
+		return 64 + bits.Len64(u.hi)
+	}
+	return bits.Len64(u.lo)
+}
+
+// trailingZeros returns the number of trailing zero bits, 128 for zero.
+func (u uint128) trailingZeros() int {
+	if u.lo != 0 {
+		return bits.TrailingZeros64(u.lo)
+	}
+	if u.hi != 0 {
+		return 64 + bits.TrailingZeros64(u.hi)
+	}
+	return 128
+}
+
+func (u uint128) big() *big.Int {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], u.hi)
+	binary.BigEndian.PutUint64(b[8:], u.lo)
+	return new(big.Int).SetBytes(b[:])
+}
+
+// u128FromBig converts a non negative big.Int, reporting false if it does not
+// fit in 128 bits.
+func u128FromBig(b *big.Int) (uint128, bool) {
+	if b.Sign() < 0 || b.BitLen() > 128 {
+		return zero128, false
+	}
+	var buf [16]byte
+	b.FillBytes(buf[:])
+	return uint128{binary.BigEndian.Uint64(buf[:8]), binary.BigEndian.Uint64(buf[8:])}, true
+}
+
+// hostMask returns a mask with the lowest n bits set.
+func hostMask(n int) uint128 {
+	if n <= 0 {
+		return zero128
+	}
+	return max128.rsh(uint(128 - n))
+}
@@ -3,6 +3,7 @@ package mapcidr
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"math"
 	"net"
 	"strings"
 )
@@ -34,9 +35,16 @@ func inc(ip net.IP) net.IP {
 // }
 
 // TotalIPSInCidrs calculates the number of ips in the diven cidrs
+//
+// The total saturates at math.MaxUint64, use CountIPsInCIDRs to get the exact
+// value for large IPv6 cidrs.
 func TotalIPSInCidrs(cidrs []*net.IPNet) (totalIPs uint64) {
 	for _, cidr := range cidrs {
-		totalIPs += AddressCountIpnet(cidr)
+		count := AddressCountIpnet(cidr)
+		if totalIPs > math.MaxUint64-count {
+			return math.MaxUint64
+		}
+		totalIPs += count
 	}
 
 	return
@@ -54,11 +62,20 @@ func AsIPV4CIDR(ipv4 string) *net.IPNet {
 	return network
 }
 
+// IsBaseIP reports whether the string is an IPv4 address ending in .0.
+//
+// Deprecated: the network address depends on the prefix, whose host range
+// is given by PrefixHostRange.
 func IsBaseIP(IP string) bool {
 	ipParsed := net.ParseIP(IP)
 	return ipParsed != nil && ipParsed.To4() != nil && strings.HasSuffix(IP, ".0")
 }
 
+// IsBroadcastIP reports whether the string is an IPv4 address ending in
+// .255.
+//
+// Deprecated: the broadcast address depends on the prefix, whose host range
+// is given by PrefixHostRange.
 func IsBroadcastIP(IP string) bool {
 	ipParsed := net.ParseIP(IP)
 	return ipParsed != nil && ipParsed.To4() != nil && strings.HasSuffix(IP, ".255")
@@ -0,0 +1,114 @@
+package mapcidr
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"net/netip"
+	"slices"
+)
+
+// SubnetRequest is a named need for a subnet with a given number of usable
+// host addresses.
+type SubnetRequest struct {
+	Name  string
+	Hosts uint64
+}
+
+// SubnetAllocation is the subnet allocated to a SubnetRequest.
+type SubnetAllocation struct {
+	Name   string
+	Hosts  uint64
+	Prefix netip.Prefix
+	// Usable is the range of the host addresses of the subnet, as returned
+	// by PrefixHostRange without its first and last addresses
+	Usable IPRange
+}
+
+// Spare returns the number of usable addresses left once the requested
+// hosts are allocated.
+func (a SubnetAllocation) Spare() *big.Int {
+	spare := a.Usable.Size()
+	return spare.Sub(spare, new(big.Int).SetUint64(a.Hosts))
+}
+
+// AllocateSubnets allocates to each request the smallest subnet of the pool
+// with enough usable hosts, using variable length subnet masks: the largest
+// subnets are allocated first, from the start of the pool, so that all of
+// them are aligned without wasting space between them. The usable hosts are
+// the ones of PrefixHostRange and NewSubnetInfo: the first and last
+// addresses of the subnets are left out, for IPv6 as well, except in /31
+// and /32 subnets (/127 and /128 in IPv6). The allocations are returned in
+// address order, and an error is returned if the pool is too small.
+func AllocateSubnets(pool netip.Prefix, requests []SubnetRequest) ([]SubnetAllocation, error) {
+	if !pool.IsValid() {
+		return nil, fmt.Errorf("invalid pool %s", pool)
+	}
+	pool = pool.Masked()
+	is4 := pool.Addr().Is4()
+	addrBits := pool.Addr().BitLen()
+
+	allocations := make([]SubnetAllocation, 0, len(requests))
+	for _, request := range requests {
+		if request.Hosts == 0 {
+			return nil, fmt.Errorf("invalid subnet request %q: no host", request.Name)
+		}
+		hostBits := subnetHostBits(request.Hosts)
+		if hostBits > addrBits-pool.Bits() {
+			return nil, fmt.Errorf("pool %s is too small: the %d hosts of %q don't fit in it", pool, request.Hosts, request.Name)
+		}
+		allocations = append(allocations, SubnetAllocation{
+			Name:   request.Name,
+			Hosts:  request.Hosts,
+			Prefix: netip.PrefixFrom(pool.Addr(), addrBits-hostBits),
+		})
+	}
+	// the order of requests of the same size is kept
+	slices.SortStableFunc(allocations, func(a, b SubnetAllocation) int {
+		return cmp.Compare(a.Prefix.Bits(), b.Prefix.Bits())
+	})
+
+	first, last := prefixRange(pool)
+	next, needed := first, new(big.Int)
+	exhausted := false
+	for i := range allocations {
+		size := one128.lsh(uint(addrBits - allocations[i].Prefix.Bits()))
+		needed.Add(needed, size.big())
+		if exhausted {
+			continue
+		}
+		end, overflow := next.addOverflow(size.subOne())
+		if overflow || end.cmp(last) > 0 {
+			exhausted = true
+			continue
+		}
+		allocations[i].Prefix = netip.PrefixFrom(next.addr(is4), allocations[i].Prefix.Bits())
+		allocations[i].Usable = PrefixHostRange(allocations[i].Prefix, true, true)
+		// a full address space ends the allocation
+		if end == hostMask(addrBits) {
+			exhausted = i < len(allocations)-1
+			continue
+		}
+		next = end.addOne()
+	}
+	if exhausted {
+		return nil, fmt.Errorf("pool %s is too small: the subnets need %s addresses, it has %s", pool, needed, PrefixAddressCount(pool))
+	}
+	return allocations, nil
+}
+
+// subnetHostBits returns the number of host bits of the smallest subnet
+// with the given number of usable hosts.
+func subnetHostBits(hosts uint64) int {
+	switch {
+	case hosts <= 2:
+		// point-to-point links have no network and broadcast addresses
+		return bits.Len64(hosts - 1)
+	case hosts == math.MaxUint64:
+		return 65
+	}
+	// network and broadcast addresses
+	return bits.Len64(hosts + 1)
+}
@@ -0,0 +1,80 @@
+package mapcidr
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocateSubnets(t *testing.T) {
+	allocations, err := AllocateSubnets(netip.MustParsePrefix("10.0.0.0/22"), []SubnetRequest{
+		{Name: "mgmt", Hosts: 10},
+		{Name: "web", Hosts: 500},
+		{Name: "db", Hosts: 60},
+	})
+	require.NoError(t, err)
+	var got [][]string
+	for _, allocation := range allocations {
+		got = append(got, []string{allocation.Name, allocation.Prefix.String(), allocation.Usable.String(), allocation.Spare().String()})
+	}
+	require.Equal(t, [][]string{
+		{"web", "10.0.0.0/23", "10.0.0.1-10.0.1.254", "10"},
+		{"db", "10.0.2.0/26", "10.0.2.1-10.0.2.62", "2"},
+		{"mgmt", "10.0.2.64/28", "10.0.2.65-10.0.2.78", "4"},
+	}, got)
+
+	// the pool is used up to its last address
+	allocations, err = AllocateSubnets(netip.MustParsePrefix("192.168.0.0/24"), []SubnetRequest{
+		{Name: "a", Hosts: 126},
+		{Name: "b", Hosts: 126},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "192.168.0.128/25", allocations[1].Prefix.String())
+	require.Equal(t, "0", allocations[1].Spare().String())
+
+	allocations, err = AllocateSubnets(netip.MustParsePrefix("2001:db8::/48"), []SubnetRequest{
+		{Name: "p2p", Hosts: 2},
+		{Name: "lan", Hosts: 1 << 40},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8::/87", allocations[0].Prefix.String())
+	require.Equal(t, "2001:db8::1-2001:db8::1ff:ffff:fffe", allocations[0].Usable.String())
+	require.Equal(t, "2001:db8::200:0:0/127", allocations[1].Prefix.String())
+	require.Equal(t, "2001:db8::200:0:0-2001:db8::200:0:1", allocations[1].Usable.String())
+
+	// the usable hosts are the hosts of NewSubnetInfo
+	for _, allocation := range allocations {
+		info, err := NewSubnetInfo(allocation.Prefix)
+		require.NoError(t, err)
+		require.Equal(t, info.Hosts, allocation.Usable.Size())
+	}
+
+	// point-to-point links are /31 subnets
+	allocations, err = AllocateSubnets(netip.MustParsePrefix("10.0.0.0/30"), []SubnetRequest{
+		{Name: "a", Hosts: 2},
+		{Name: "b", Hosts: 1},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.0/31", allocations[0].Prefix.String())
+	require.Equal(t, "10.0.0.0-10.0.0.1", allocations[0].Usable.String())
+	require.Equal(t, "10.0.0.2/32", allocations[1].Prefix.String())
+
+	// a whole address space
+	allocations, err = AllocateSubnets(netip.MustParsePrefix("0.0.0.0/0"), []SubnetRequest{{Name: "all", Hosts: 1<<32 - 2}})
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0.0/0", allocations[0].Prefix.String())
+
+	_, err = AllocateSubnets(netip.MustParsePrefix("10.0.0.0/24"), []SubnetRequest{
+		{Name: "web", Hosts: 200},
+		{Name: "db", Hosts: 10},
+	})
+	require.EqualError(t, err, "pool 10.0.0.0/24 is too small: the subnets need 272 addresses, it has 256")
+
+	_, err = AllocateSubnets(netip.MustParsePrefix("10.0.0.0/24"), []SubnetRequest{{Name: "web", Hosts: 255}})
+	require.Error(t, err)
+	_, err = AllocateSubnets(netip.MustParsePrefix("0.0.0.0/0"), []SubnetRequest{{Name: "web", Hosts: 1 << 32}})
+	require.Error(t, err)
+	_, err = AllocateSubnets(netip.MustParsePrefix("10.0.0.0/24"), []SubnetRequest{{Name: "web"}})
+	require.Error(t, err)
+}